@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/RAshkettle/getter/internal/files"
+	"github.com/RAshkettle/getter/internal/store"
+)
+
+// errNotAcceptable is returned by negotiateFormat when none of the formats
+// the client accepts is available.
+var errNotAcceptable = errors.New("no acceptable format")
+
+// responseFormat is a format collections can be returned in.
+type responseFormat struct {
+	// name selects the format in the _format query parameter.
+	name string
+
+	// contentType is the Content-Type of responses in the format.
+	contentType string
+
+	// mediaTypes are the media types that select the format in an Accept
+	// header. The first one is the format's own.
+	mediaTypes []string
+}
+
+// responseFormats are the formats collections can be returned in, with the
+// default first.
+var responseFormats = []responseFormat{
+	{name: "json", contentType: "application/json", mediaTypes: []string{"application/json"}},
+	{name: "ndjson", contentType: "application/x-ndjson", mediaTypes: []string{"application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines"}},
+	{name: "csv", contentType: "text/csv; charset=utf-8", mediaTypes: []string{"text/csv"}},
+	{name: "yaml", contentType: "application/yaml", mediaTypes: []string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"}},
+	{name: "xml", contentType: "application/xml", mediaTypes: []string{"application/xml", "text/xml"}},
+}
+
+// formatAliases maps other names accepted by _format to format names.
+var formatAliases = map[string]string{"jsonl": "ndjson", "yml": "yaml"}
+
+// negotiateFormat chooses the format of a collection response. A _format
+// query parameter, such as ?_format=csv, names the format outright. Otherwise
+// the Accept header is honored: the format with the highest quality value
+// wins; on a tie, the one matched by the more specific media range, then by
+// the range listed first, then JSON before the other formats. Without an
+// Accept header, or for */*, the response is JSON. JSON is also preferred when
+// XML wins only at a quality below 1 and JSON is accepted through */*, as
+// browsers send "text/html,application/xml;q=0.9,*/*;q=0.8" and are better
+// served JSON.
+//
+// Parameters:
+//   - r: The HTTP request being processed
+//
+// Returns:
+//   - *responseFormat: The chosen format
+//   - error: An error wrapping errNotAcceptable if no format is acceptable
+func negotiateFormat(r *http.Request) (*responseFormat, error) {
+	if name := r.URL.Query().Get("_format"); name != "" {
+		name = strings.ToLower(name)
+		if alias, ok := formatAliases[name]; ok {
+			name = alias
+		}
+		for i := range responseFormats {
+			if responseFormats[i].name == name {
+				return &responseFormats[i], nil
+			}
+		}
+		return nil, fmt.Errorf("%w: unknown format %q, use one of %s", errNotAcceptable, name, formatNames())
+	}
+
+	ranges := parseAccept(strings.Join(r.Header.Values("Accept"), ","))
+	if len(ranges) == 0 {
+		return &responseFormats[0], nil
+	}
+
+	var best *responseFormat
+	var bestMatch acceptMatch
+	for i := range responseFormats {
+		match := responseFormats[i].match(ranges)
+		if match.q > 0 && (best == nil || match.better(bestMatch)) {
+			best, bestMatch = &responseFormats[i], match
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w: collections are available as %s", errNotAcceptable, formatNames())
+	}
+	if best.name == "xml" && bestMatch.q < 1 {
+		if match := responseFormats[0].match(ranges); match.q > 0 && match.specificity == 0 {
+			return &responseFormats[0], nil
+		}
+	}
+	return best, nil
+}
+
+// formatNames lists the names of the response formats for error messages.
+func formatNames() string {
+	names := make([]string, len(responseFormats))
+	for i, f := range responseFormats {
+		names[i] = f.name
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// acceptRange is a media range of an Accept header, such as text/* or
+// application/json, with its quality value.
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses the media ranges of an Accept header, in order.
+// Malformed ranges and quality values are skipped.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// acceptMatch describes how a format is matched by an Accept header.
+type acceptMatch struct {
+	// q is the quality value of the matching range, 0 if there is none.
+	q float64
+
+	// specificity is 2 for a full media type, 1 for type/* and 0 for */*.
+	specificity int
+
+	// index is the position of the matching range in the header.
+	index int
+}
+
+// better reports whether m ranks above other, as described for negotiateFormat.
+func (m acceptMatch) better(other acceptMatch) bool {
+	if m.q != other.q {
+		return m.q > other.q
+	}
+	if m.specificity != other.specificity {
+		return m.specificity > other.specificity
+	}
+	return m.index < other.index
+}
+
+// match finds the range of an Accept header that applies to the format: the
+// most specific one matching any of its media types, as more specific ranges
+// override less specific ones.
+func (f *responseFormat) match(ranges []acceptRange) acceptMatch {
+	best := acceptMatch{specificity: -1}
+	for i, ar := range ranges {
+		for _, mediaType := range f.mediaTypes {
+			specificity := -1
+			switch {
+			case ar.mediaType == mediaType:
+				specificity = 2
+			case ar.mediaType == "*/*":
+				specificity = 0
+			case strings.HasSuffix(ar.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(ar.mediaType, "*")):
+				specificity = 1
+			}
+			if specificity > best.specificity || specificity == best.specificity && specificity >= 0 && ar.q > best.q {
+				best = acceptMatch{q: ar.q, specificity: specificity, index: i}
+			}
+		}
+	}
+	return best
+}
+
+// writeCollection answers a collection request in the negotiated format.
+// JSON and YAML responses hold doc, which has the shape of the data file;
+// NDJSON, CSV and XML responses hold only the records, one per line, row or
+// <record> element, except that XML holds doc for a file with a single object.
+// CSV responses are sent as a download named after the collection, with the
+// columns of a CSV or TSV data file kept in their order.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - format: The negotiated format
+//   - coll: The collection the records belong to
+//   - doc: The response in the shape of the data file
+//   - records: The records of the response
+func (app *application) writeCollection(w http.ResponseWriter, r *http.Request, format *responseFormat, coll *store.Collection, doc interface{}, records []map[string]interface{}) {
+	if format.name == "json" {
+		app.writeJSON(w, r, http.StatusOK, doc)
+		return
+	}
+
+	values := make([]interface{}, len(records))
+	for i, record := range records {
+		values[i] = record
+	}
+
+	var content []byte
+	var err error
+	switch format.name {
+	case "ndjson":
+		content, err = store.Encode(files.FormatNDJSON, values, nil)
+	case "csv":
+		content, err = store.Encode(files.FormatCSV, values, coll.Columns())
+		filename := path.Base(coll.Name()) + ".csv"
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	case "yaml":
+		content, err = store.Encode(files.FormatYAML, doc, nil)
+	case "xml":
+		if coll.IsSingleton() {
+			content, err = encodeXML(doc)
+		} else {
+			content, err = encodeXML(values)
+		}
+	}
+	if err != nil {
+		w.Header().Del("Content-Disposition")
+		app.serverError(w, r, fmt.Errorf("error encoding response as %s: %w", format.name, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestNegotiateFormat tests choosing the response format from the Accept
+// header and the _format parameter
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		url      string
+		expected string
+	}{
+		{name: "No Accept header", url: "/products", expected: "json"},
+		{name: "Any type", accept: "*/*", url: "/products", expected: "json"},
+		{name: "CSV", accept: "text/csv", url: "/products", expected: "csv"},
+		{name: "NDJSON alias", accept: "application/jsonl", url: "/products", expected: "ndjson"},
+		{name: "Case and parameters", accept: "Application/YAML; charset=utf-8", url: "/products", expected: "yaml"},
+		{name: "Quality values", accept: "application/json;q=0.5, application/xml", url: "/products", expected: "xml"},
+		{name: "Specific range beats wildcard", accept: "*/*, text/csv", url: "/products", expected: "csv"},
+		{name: "Wildcard subtype", accept: "text/*", url: "/products", expected: "csv"},
+		{name: "First listed on a tie", accept: "application/xml, application/json", url: "/products", expected: "xml"},
+		{name: "Excluded by q=0", accept: "application/json;q=0, */*;q=0.1", url: "/products", expected: "ndjson"},
+		{name: "Malformed range skipped", accept: "text/csv;q=high, application/yaml", url: "/products", expected: "yaml"},
+		{name: "Browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", url: "/products", expected: "json"},
+		{name: "XML below 1 without a wildcard", accept: "application/xml;q=0.9, application/json;q=0.5", url: "/products", expected: "xml"},
+		{name: "XML at 1 with a wildcard", accept: "application/xml, */*;q=0.8", url: "/products", expected: "xml"},
+		{name: "Format parameter overrides", accept: "application/xml", url: "/products?_format=CSV", expected: "csv"},
+		{name: "Format alias", url: "/products?_format=yml", expected: "yaml"},
+		{name: "Nothing acceptable", accept: "text/html", url: "/products"},
+		{name: "Everything excluded", accept: "*/*;q=0", url: "/products"},
+		{name: "Unknown format", url: "/products?_format=pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			format, err := negotiateFormat(r)
+			if tt.expected == "" {
+				if !errors.Is(err, errNotAcceptable) {
+					t.Errorf("Expected errNotAcceptable, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("negotiateFormat() error = %v", err)
+			}
+			if format.name != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, format.name)
+			}
+		})
+	}
+}
+
+// TestResponseFormats tests collections returned in each format
+func TestResponseFormats(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"products.csv":   "title,id,price,size.w\nLamp,1,12.50,30\nDesk & Chair,2,,\n",
+		"settings.json":  `{"theme": "dark"}`,
+		"events.ndjson":  "{\"id\": 1, \"type\": \"click\"}\n{\"id\": 2, \"type\": \"view\"}\n",
+		"customers.json": `{"customers": [{"id": 1, "name": "Ann"}], "version": 2}`,
+	})
+
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		status      int
+		contentType string
+		disposition string
+		expected    string
+	}{
+		{
+			name:        "CSV keeps the file's columns",
+			url:         "/products",
+			accept:      "text/csv",
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			disposition: `attachment; filename=products.csv`,
+			expected:    "title,id,price,size.w\nLamp,1,12.50,30\nDesk & Chair,2,,\n",
+		},
+		{
+			name:        "NDJSON with filters",
+			url:         "/products?_format=ndjson&price_gt=10&_fields=id,title",
+			status:      http.StatusOK,
+			contentType: "application/x-ndjson",
+			expected:    "{\"id\":1,\"title\":\"Lamp\"}\n",
+		},
+		{
+			name:        "YAML",
+			url:         "/products?id=2",
+			accept:      "application/yaml",
+			status:      http.StatusOK,
+			contentType: "application/yaml",
+			expected:    "- id: 2\n  price: null\n  size:\n    w: null\n  title: Desk & Chair\n",
+		},
+		{
+			name:        "XML",
+			url:         "/products?id=2&_fields=title,price",
+			accept:      "text/xml",
+			status:      http.StatusOK,
+			contentType: "application/xml",
+			expected: "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+				"<records xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\">\n" +
+				"  <record>\n    <price xsi:nil=\"true\"></price>\n    <title>Desk &amp; Chair</title>\n  </record>\n</records>\n",
+		},
+		{
+			name:        "Collection under a key as XML",
+			url:         "/customers?_format=xml",
+			status:      http.StatusOK,
+			contentType: "application/xml",
+			expected: "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+				"<records xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\">\n" +
+				"  <record>\n    <id>1</id>\n    <name>Ann</name>\n  </record>\n</records>\n",
+		},
+		{
+			name:        "Browser gets JSON",
+			url:         "/customers",
+			accept:      "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			expected:    "{\n  \"customers\": [\n    {\n      \"id\": 1,\n      \"name\": \"Ann\"\n    }\n  ],\n  \"version\": 2\n}\n",
+		},
+		{
+			name:        "Singleton as XML",
+			url:         "/settings?_format=xml",
+			status:      http.StatusOK,
+			contentType: "application/xml",
+			expected: "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+				"<object xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\">\n  <theme>dark</theme>\n</object>\n",
+		},
+		{
+			name:        "Streamed NDJSON",
+			url:         "/events?type=view",
+			accept:      "application/x-ndjson",
+			status:      http.StatusOK,
+			contentType: "application/x-ndjson",
+			expected:    "{\"id\":2,\"type\":\"view\"}\n",
+		},
+		{
+			name:        "NDJSON file as CSV",
+			url:         "/events",
+			accept:      "text/csv",
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			disposition: `attachment; filename=events.csv`,
+			expected:    "id,type\n1,click\n2,view\n",
+		},
+		{
+			name:        "Not acceptable",
+			url:         "/products",
+			accept:      "text/html, application/pdf",
+			status:      http.StatusNotAcceptable,
+			contentType: problemContentType,
+		},
+		{
+			name:        "Missing collection in an unknown format",
+			url:         "/missing?_format=pdf",
+			status:      http.StatusNotFound,
+			contentType: problemContentType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != tt.contentType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.contentType, contentType)
+			}
+			if disposition := w.Header().Get("Content-Disposition"); disposition != tt.disposition {
+				t.Errorf("Expected Content-Disposition %q, got %q", tt.disposition, disposition)
+			}
+			if vary := w.Header().Get("Vary"); vary != "Accept" && tt.status != http.StatusNotFound {
+				t.Errorf("Expected Vary: Accept, got %q", vary)
+			}
+			if tt.expected != "" && w.Body.String() != tt.expected {
+				t.Errorf("Expected body:\n%s\ngot:\n%s", tt.expected, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestEncodeXML tests the XML form of nested values and awkward keys
+func TestEncodeXML(t *testing.T) {
+	doc := map[string]interface{}{
+		"products": []interface{}{
+			map[string]interface{}{"id": json.Number("1"), "tags": []interface{}{"a", nil}, "first name": "Ann", "xmlns": "x", "9lives": true},
+		},
+		"version": json.Number("2"),
+	}
+
+	content, err := encodeXML(doc)
+	if err != nil {
+		t.Fatalf("encodeXML() error = %v", err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<object xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <products>
+    <item>
+      <field name="9lives">true</field>
+      <field name="first name">Ann</field>
+      <id>1</id>
+      <tags>
+        <item>a</item>
+        <item xsi:nil="true"></item>
+      </tags>
+      <field name="xmlns">x</field>
+    </item>
+  </products>
+  <version>2</version>
+</object>
+`
+	if string(content) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, content)
+	}
+
+	if _, err := encodeXML(map[string]interface{}{"bad": struct{}{}}); err == nil {
+		t.Error("Expected an error for a value that can't be written")
+	}
+}
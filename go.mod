@@ -5,4 +5,5 @@ go 1.24.2
 require (
 	github.com/joho/godotenv v1.5.1
 	github.com/justinas/alice v1.2.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -2,22 +2,32 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/RAshkettle/getter/internal/files"
+	"github.com/RAshkettle/getter/internal/query"
+	"github.com/RAshkettle/getter/internal/store"
 )
 
+// errIDMismatch is returned when the body of an update tries to change the id
+// of a record.
+var errIDMismatch = errors.New("record id in body does not match URL")
+
 // home handles HTTP requests to the application's root endpoint.
 // It returns a JSON response containing a list of all files in the application's
 // configured data directory, along with success status and count information.
 //
 // The response has the following structure:
 //   - status: A string indicating request processing status ("success")
-//   - files: An array of strings with the names of files in the data directory
+//   - files: An array with the name of each file in the data directory and its
+//     format ("json", "yaml", "csv", "tsv" or "ndjson"), which is left out for
+//     files that aren't data files
 //   - count: An integer representing the total number of files
 //
 // If the file listing operation fails, a 500 Internal Server Error is returned
@@ -34,6 +44,11 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Leave out temporary files from interrupted writes
+	fileList = slices.DeleteFunc(fileList, func(file files.File) bool {
+		return files.IsTemporary(file.Name)
+	})
+
 	// Create a response structure
 	response := map[string]interface{}{
 		"status": "success",
@@ -53,8 +68,36 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 }
 
 // getFileRecords handles requests for all records from a JSON file.
-// The filename is extracted from the URL path and the corresponding JSON file
-// is loaded from the application's data directory.
+// The filename is extracted from the URL path and the corresponding collection
+// is served from the application's store, in the same shape as the file itself.
+//
+// Query parameters filter the records by field value, for example
+// ?lastName=Chen&address.state=OR. Nested fields use dotted paths, a repeated
+// parameter matches any of its values and values are compared according to the
+// field's type, so ?id=1 matches both numeric and string ids. Operator suffixes
+// such as price_gte=100 or title_like=laptop are described in
+// query.ParseFilters. q=portland searches every string value of each record and
+// ranks the results by the number of matching fields; see query.ParseSearch.
+// The _sort parameter orders the records by one or more fields, e.g.
+// ?_sort=price,-title. _page and _limit, or _start and _end, return one page of
+// the results with a Link header pointing at the first, previous, next and last
+// pages. In cursor mode, _cursor (empty for the first page) and _limit return
+// the records after the cursor, with the cursor of the next page in the
+// X-Next-Cursor header. The X-Total-Count header always holds the number of
+// matching records. _expand and _embed add related records as for
+// getFileRecordByID. _fields=id,title keeps only the listed fields of each
+// record and _exclude=description removes fields. A malformed parameter returns
+// a 400 Bad Request.
+//
+// A file holding a single object rather than records, such as settings.json,
+// is returned as that object; only _fields and _exclude apply to it.
+//
+// The response is JSON unless the Accept header or the _format parameter asks
+// for NDJSON, CSV, YAML or XML; see negotiateFormat and writeCollection. A 406
+// Not Acceptable is returned if none of the accepted formats is available.
+//
+// The records of an NDJSON file are streamed from disk without loading the
+// collection unless the query needs them all at once; see streams.
 //
 // URL Pattern: /{filename} - where filename should be a JSON file (without the .json extension)
 //
@@ -65,41 +108,132 @@ func (app *application) getFileRecords(w http.ResponseWriter, r *http.Request) {
 	// Extract filename from the URL path
 	filename := r.PathValue("filename")
 	if filename == "" {
-		http.Error(w, "Missing file name", http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest, "Missing file name")
+		return
+	}
+
+	q, err := query.Parse(r.URL.Query())
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	
-	if !strings.HasSuffix(filename, ".json") {
-		filename = filename + ".json"
+	// The collection is found before the format is negotiated, so a missing
+	// one is a 404 in any format. NDJSON files are only checked for, as their
+	// records may be streamed without loading them.
+	fileFormat, err := app.store.Format(filename)
+	if err != nil {
+		app.collectionError(w, r, filename, err)
+		return
 	}
-	filePath := filepath.Join(app.dataPath, filename)
-fileContent, err := getRecords(filePath)
-	if err != nil{
-		app.serverError(w,r,err)
-		return 
+	var coll *store.Collection
+	if fileFormat != files.FormatNDJSON {
+		if coll, err = app.store.Collection(filename); err != nil {
+			app.collectionError(w, r, filename, err)
+			return
+		}
 	}
 
-	// Validate JSON format
-	var records interface{}
-	if err := json.Unmarshal(fileContent, &records); err != nil {
-		app.serverError(w, r, fmt.Errorf("invalid JSON in file %s: %w", filename, err))
+	format, ok := app.responseFormat(w, r)
+	if !ok {
 		return
 	}
 
-	// Set content type header
-	w.Header().Set("Content-Type", "application/json")
+	if coll == nil {
+		if app.streams(r, fileFormat, q, format) {
+			app.streamRecords(w, r, filename, q, format)
+			return
+		}
+		if coll, err = app.store.Collection(filename); err != nil {
+			app.collectionError(w, r, filename, err)
+			return
+		}
+	}
+
+	if coll.IsSingleton() {
+		object := coll.Object()
+		if q.Projection != nil {
+			object = q.Projection.Apply(object)
+		}
+		app.writeCollection(w, r, format, coll, object, []map[string]interface{}{object})
+		return
+	}
+
+	app.writeRecords(w, r, coll, q, format)
+}
+
+// responseFormat negotiates the format of a collection response with
+// negotiateFormat, answering with a 406 Not Acceptable if there is none.
+// Responses vary with the Accept header either way.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//
+// Returns:
+//   - *responseFormat: The negotiated format
+//   - bool: False if a 406 Not Acceptable was sent
+func (app *application) responseFormat(w http.ResponseWriter, r *http.Request) (*responseFormat, bool) {
+	w.Header().Add("Vary", "Accept")
+	format, err := negotiateFormat(r)
+	if err != nil {
+		app.clientError(w, r, http.StatusNotAcceptable, err.Error())
+		return nil, false
+	}
+	return format, true
+}
+
+// writeRecords answers a collection request with the records of coll
+// selected by q, setting the pagination headers.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - coll: The collection to read
+//   - q: The parsed query string of the request
+//   - format: The negotiated response format
+func (app *application) writeRecords(w http.ResponseWriter, r *http.Request, coll *store.Collection, q *query.Query, format *responseFormat) {
+	var err error
+	q.IDPaths = coll.IDFields()
+	if q.Expand, err = app.relationExpander(coll, r.URL.Query()); err != nil {
+		app.relationError(w, r, err)
+		return
+	}
 
-	// Write the JSON response
-	w.Write(fileContent)
+	// Searches use the collection's index; other queries don't need it built
+	var result *query.Result
+	if q.Search != nil {
+		records, index := coll.Indexed()
+		result = q.Apply(records, index)
+	} else {
+		result = q.Apply(coll.Records(), nil)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(result.Total))
+	switch {
+	case q.Page != nil:
+		w.Header().Set("Link", q.Page.Link(requestURL(r), result.Total))
+	case q.Cursor != nil && result.NextCursor != "":
+		w.Header().Set("X-Next-Cursor", result.NextCursor)
+		w.Header().Set("Link", q.Cursor.Link(requestURL(r), result.NextCursor))
+	}
+
+	app.writeCollection(w, r, format, coll, coll.Document(result.Records), result.Records)
 }
 
-// getFileRecordByID handles requests for a single record by ID from a JSON file.
-// It retrieves the record that matches the specified ID from the JSON file.
-// The file is expected to contain a single JSON object with a property containing an array of records.
+// getFileRecordByID handles requests for a single record by ID from a collection.
+// It retrieves the record that matches the specified ID from the collection's
+// records, whether the data file holds them as a top-level array or under a
+// key of its top-level object; see store.Store.Collection.
+// _expand=customer inlines the record the customerId field refers to and
+// _embed=orders attaches the records of orders.json that refer to this one;
+// see relationExpander. The _fields and _exclude parameters then select which
+// fields of the record are returned.
+//
+// A 404 Not Found is returned if the collection or the record doesn't exist.
 //
 // URL Pattern: /{filename}/{id} - where:
-//   - filename should be a JSON file (without the .json extension)
+//   - filename is the collection name, a data file without its extension
 //   - id is the unique identifier for the record to retrieve
 //
 // Parameters:
@@ -109,114 +243,862 @@ func (app *application) getFileRecordByID(w http.ResponseWriter, r *http.Request
 	// Extract filename and ID from the URL path
 	filename := r.PathValue("filename")
 	id := r.PathValue("id")
-	
+
 	// Validate inputs
 	if filename == "" {
-		http.Error(w, "Missing file name", http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest, "Missing file name")
+		return
+	}
+
+	if id == "" {
+		app.clientError(w, r, http.StatusBadRequest, "Missing record ID")
+		return
+	}
+
+	projection, err := query.ParseProjection(r.URL.Query())
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	coll, err := app.store.Collection(filename)
+	if err != nil {
+		app.collectionError(w, r, filename, err)
+		return
+	}
+
+	// In a singleton the id segment is the first member of a path
+	if coll.IsSingleton() {
+		app.getSingletonPath(w, r, coll)
+		return
+	}
+
+	matchedRecord, ok := coll.Get(id)
+	if !ok {
+		app.clientError(w, r, http.StatusNotFound, fmt.Sprintf("Record with ID %s not found", id))
+		return
+	}
+	expand, err := app.relationExpander(coll, r.URL.Query())
+	if err != nil {
+		app.relationError(w, r, err)
+		return
+	}
+	if expand != nil {
+		matchedRecord = expand([]map[string]interface{}{matchedRecord})[0]
+	}
+	if projection != nil {
+		matchedRecord = projection.Apply(matchedRecord)
+	}
+
+	app.writeJSON(w, r, http.StatusOK, matchedRecord)
+}
+
+// replaceFile handles requests to replace the object of a singleton, a file
+// holding a single object such as settings.json, with the request body.
+//
+// URL Pattern: /{filename}
+//
+// On success the new object is returned. Collections can't be replaced as a
+// whole; they answer with a 405 Method Not Allowed.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) replaceFile(w http.ResponseWriter, r *http.Request) {
+	app.updateFile(w, r, func(current, body map[string]interface{}) map[string]interface{} {
+		return body
+	})
+}
+
+// patchFile handles requests to merge the request body into the object of a
+// singleton as a JSON Merge Patch (RFC 7396).
+//
+// URL Pattern: /{filename}
+//
+// On success the updated object is returned. Collections answer with a 405
+// Method Not Allowed.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) patchFile(w http.ResponseWriter, r *http.Request) {
+	app.updateFile(w, r, func(current, body map[string]interface{}) map[string]interface{} {
+		return mergePatch(current, body).(map[string]interface{})
+	})
+}
+
+// updateFile implements the shared flow of PUT and PATCH requests to a
+// singleton: it decodes the request body, computes the new object with update
+// and writes the file back to disk.
+func (app *application) updateFile(w http.ResponseWriter, r *http.Request, update func(current, body map[string]interface{}) map[string]interface{}) {
+	filename := r.PathValue("filename")
+	if filename == "" {
+		app.clientError(w, r, http.StatusBadRequest, "Missing file name")
+		return
+	}
+
+	coll, err := app.store.Collection(filename)
+	if err != nil {
+		app.collectionError(w, r, filename, err)
+		return
+	}
+
+	if !coll.IsSingleton() {
+		w.Header().Set("Allow", app.allowedMethods(r))
+		app.clientError(w, r, http.StatusMethodNotAllowed, "Collections can't be replaced as a whole")
+		return
+	}
+
+	var body map[string]interface{}
+	if err := store.DecodeJSON(readBody(r), &body); err != nil || body == nil {
+		app.clientError(w, r, http.StatusBadRequest, "Request body must be a JSON object")
+		return
+	}
+
+	object, err := coll.Replace(func(current map[string]interface{}) (map[string]interface{}, error) {
+		return update(current, body), nil
+	})
+	if err != nil {
+		app.storeError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, object)
+}
+
+// createFileRecord handles requests to add a new record to a JSON file.
+// The request body must be a JSON object. If it has no id, one is generated
+// with the strategy configured for the collection; an id that is already in
+// use is rejected with a 409 Conflict. The record is appended to the array of
+// records inside the file and the file is written back to disk. An NDJSON file
+// instead gets the record as a new line, without being loaded or rewritten.
+//
+// URL Pattern: /{filename} - where filename should be a JSON file (without the .json extension)
+//
+// On success a 201 Created response is returned containing the new record, with a
+// Location header pointing at /{filename}/{id}.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) createFileRecord(w http.ResponseWriter, r *http.Request) {
+	// Extract filename from the URL path
+	filename := r.PathValue("filename")
+	if filename == "" {
+		app.clientError(w, r, http.StatusBadRequest, "Missing file name")
+		return
+	}
+
+	// Decode the new record from the request body
+	var record map[string]interface{}
+	if err := store.DecodeJSON(readBody(r), &record); err != nil || record == nil {
+		app.clientError(w, r, http.StatusBadRequest, "Request body must be a JSON object")
+		return
+	}
+
+	coll, err := app.store.Append(filename, record, app.idGenerator)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.collectionError(w, r, filename, err)
+	case err != nil:
+		app.storeError(w, r, err)
+	default:
+		app.writeCreated(w, r, coll, record)
+	}
+}
+
+// insertRecord adds a record to coll and answers with 201 Created and a
+// Location header pointing at the new record.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - coll: The collection to add the record to
+//   - record: The decoded request body
+func (app *application) insertRecord(w http.ResponseWriter, r *http.Request, coll *store.Collection, record map[string]interface{}) {
+	record, err := coll.Insert(record, app.idGenerator(coll.Name()))
+	if err != nil {
+		app.storeError(w, r, err)
+		return
+	}
+	app.writeCreated(w, r, coll, record)
+}
+
+// writeCreated answers with 201 Created, the new record and a Location
+// header pointing at it.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - coll: The collection the record was added to
+//   - record: The stored record
+func (app *application) writeCreated(w http.ResponseWriter, r *http.Request, coll *store.Collection, record map[string]interface{}) {
+	// Commas are kept as they separate the values of composite keys
+	id := strings.ReplaceAll(url.PathEscape(coll.RecordID(record)), "%2C", ",")
+	w.Header().Set("Location", "/"+coll.Name()+"/"+id)
+	app.writeJSON(w, r, http.StatusCreated, record)
+}
+
+// getChildRecords handles requests for the records of a child collection that
+// belong to a parent record, for example the orders of a customer. The child
+// records are those whose foreign key, customerId for a customers parent or a
+// field declared with -relation, holds the parent's id. All the query
+// parameters of getFileRecords apply to them.
+//
+// URL Pattern: /{filename}/{id}/{child} - e.g. /customers/CUST-10058429/orders,
+// dispatched by getRecordPath when the record has no field named {child}
+//
+// A 404 Not Found is returned if the parent record or the child collection
+// doesn't exist.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) getChildRecords(w http.ResponseWriter, r *http.Request) {
+	q, err := query.Parse(r.URL.Query())
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	children, rel, parentID, ok := app.childCollection(w, r)
+	if !ok {
+		return
+	}
+
+	format, ok := app.responseFormat(w, r)
+	if !ok {
+		return
+	}
+
+	// Select the children with an equality filter on the foreign key
+	filters, err := query.ParseFilters(url.Values{rel.field: {fmt.Sprintf("%v", parentID)}})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	q.Filters = append(q.Filters, filters...)
+
+	app.writeRecords(w, r, children, q, format)
+}
+
+// createChildRecord handles requests to add a record to a child collection
+// under a parent record, for example a new order for a customer. The foreign
+// key of the new record is set to the parent's id; a different value in the
+// body is rejected with a 400 Bad Request.
+//
+// URL Pattern: /{filename}/{id}/{child} - e.g. /customers/CUST-10058429/orders
+//
+// On success a 201 Created response is returned containing the new record, with
+// a Location header pointing at /{child}/{id}. A 404 Not Found is returned if
+// the parent record or the child collection doesn't exist.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) createChildRecord(w http.ResponseWriter, r *http.Request) {
+	var record map[string]interface{}
+	if err := store.DecodeJSON(readBody(r), &record); err != nil || record == nil {
+		app.clientError(w, r, http.StatusBadRequest, "Request body must be a JSON object")
+		return
+	}
+
+	children, rel, parentID, ok := app.childCollection(w, r)
+	if !ok {
+		return
+	}
+
+	if key, ok := record[rel.field]; ok && fmt.Sprintf("%v", key) != fmt.Sprintf("%v", parentID) {
+		app.clientError(w, r, http.StatusBadRequest, fmt.Sprintf("%s in body does not match URL", rel.field))
+		return
+	}
+
+	// Store the parent's id with its original type, e.g. a number
+	record[rel.field] = parentID
+
+	app.insertRecord(w, r, children, record)
+}
+
+// childCollection resolves the parent record and child collection of a nested
+// route. If either doesn't exist, it answers the request with a 404 Not Found.
+// The parent's id is returned as the child records' foreign key holds it: the
+// value of the parent's id field, or the joined values of a composite key.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//
+// Returns:
+//   - *store.Collection: The child collection
+//   - relation: The relation linking the child records to the parent
+//   - interface{}: The id of the parent record
+//   - bool: False if the request has already been answered
+func (app *application) childCollection(w http.ResponseWriter, r *http.Request) (*store.Collection, relation, interface{}, bool) {
+	filename := r.PathValue("filename")
+	id := r.PathValue("id")
+	child := r.PathValue("child")
+
+	parents, err := app.store.Collection(filename)
+	if err != nil {
+		app.collectionError(w, r, filename, err)
+		return nil, relation{}, nil, false
+	}
+	parent, ok := parents.Get(id)
+	if !ok {
+		app.clientError(w, r, http.StatusNotFound, fmt.Sprintf("Record with ID %s not found", id))
+		return nil, relation{}, nil, false
+	}
+
+	rel, err := app.embedRelation(parents.Name(), child)
+	if err != nil {
+		app.clientError(w, r, http.StatusNotFound, fmt.Sprintf("Collection %s not found", child))
+		return nil, relation{}, nil, false
+	}
+
+	children, err := app.store.Collection(rel.child)
+	if err != nil {
+		app.collectionError(w, r, rel.child, err)
+		return nil, relation{}, nil, false
+	}
+	return children, rel, parents.IDValue(parent), true
+}
+
+// replaceFileRecord handles requests to replace a record in a JSON file.
+// The request body must be a JSON object and becomes the new record; the
+// record keeps the id from the URL, so id fields in the body must match it.
+//
+// URL Pattern: /{filename}/{id}
+//
+// On success the updated record is returned. A 404 Not Found is returned if no
+// record has the specified id.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) replaceFileRecord(w http.ResponseWriter, r *http.Request) {
+	if app.isSingleton(r) {
+		app.replaceRecordPath(w, r)
+		return
+	}
+	app.updateFileRecord(w, r, func(current, body map[string]interface{}) map[string]interface{} {
+		return body
+	})
+}
+
+// patchFileRecord handles requests to partially update a record in a JSON file.
+// The request body is applied to the record as a JSON Merge Patch (RFC 7396):
+// fields in the body replace those in the record, nested objects are merged
+// recursively and fields set to null are removed.
+//
+// URL Pattern: /{filename}/{id}
+//
+// On success the updated record is returned. A 404 Not Found is returned if no
+// record has the specified id.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) patchFileRecord(w http.ResponseWriter, r *http.Request) {
+	if app.isSingleton(r) {
+		app.patchRecordPath(w, r)
+		return
+	}
+	app.updateFileRecord(w, r, func(current, body map[string]interface{}) map[string]interface{} {
+		return mergePatch(current, body).(map[string]interface{})
+	})
+}
+
+// updateFileRecord implements the shared flow of PUT and PATCH requests: it
+// decodes the request body, locates the record by id, computes the new record
+// with update and writes the file back to disk.
+func (app *application) updateFileRecord(w http.ResponseWriter, r *http.Request, update func(current, body map[string]interface{}) map[string]interface{}) {
+	filename := r.PathValue("filename")
+	id := r.PathValue("id")
+
+	if filename == "" {
+		app.clientError(w, r, http.StatusBadRequest, "Missing file name")
 		return
 	}
-	
+
 	if id == "" {
-		http.Error(w, "Missing record ID", http.StatusBadRequest)
-		return
-	}
-	
-	// Add .json extension if needed
-	if !strings.HasSuffix(filename, ".json") {
-		filename = filename + ".json"
-	}
-	
-	// Construct full file path
-	filePath := filepath.Join(app.dataPath, filename)
-	
-	// Get file content
-	fileContent, err := getRecords(filePath)
-	if err != nil {
-		app.serverError(w, r, fmt.Errorf("error reading file %s: %w", filename, err))
-		return
-	}
-	
-	// Parse the JSON file - it contains a single object with a property that holds an array of records
-	var fileData map[string][]map[string]interface{}
-	if err := json.Unmarshal(fileContent, &fileData); err != nil {
-		app.serverError(w, r, fmt.Errorf("invalid JSON in file %s: %w", filename, err))
-		return
-	}
-	
-	// Find the array of records (we don't know the key name in advance)
-	var records []map[string]interface{}
-	var found bool
-	
-	// Check each key in the object to find an array of records
-	for _, value := range fileData {
-		if len(value) > 0 {
-			// We found an array with at least one record
-			records = value
-			found = true
-			break
+		app.clientError(w, r, http.StatusBadRequest, "Missing record ID")
+		return
+	}
+
+	var body map[string]interface{}
+	if err := store.DecodeJSON(readBody(r), &body); err != nil || body == nil {
+		app.clientError(w, r, http.StatusBadRequest, "Request body must be a JSON object")
+		return
+	}
+
+	coll, err := app.store.Collection(filename)
+	if err != nil {
+		app.collectionError(w, r, filename, err)
+		return
+	}
+
+	record, err := coll.Update(id, func(current map[string]interface{}) (map[string]interface{}, error) {
+		// The id can't be changed through an update
+		for _, field := range coll.IDFields() {
+			if value, ok := body[field]; ok && fmt.Sprintf("%v", value) != fmt.Sprintf("%v", current[field]) {
+				return nil, errIDMismatch
+			}
 		}
+		return update(current, body), nil
+	})
+	if errors.Is(err, errIDMismatch) {
+		app.clientError(w, r, http.StatusBadRequest, "Record ID in body does not match URL")
+		return
 	}
-	
-	if !found {
-		// No arrays with records found
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{})
-		return
-	}
-	
-	// Search for the record with matching ID
-	var matchedRecord map[string]interface{}
-	for _, record := range records {
-		// Convert IDs to strings for reliable comparison
-		recordID := fmt.Sprintf("%v", record["id"])
-		if recordID == id {
-			matchedRecord = record
-			break
+	if err != nil {
+		app.storeError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, record)
+}
+
+// deleteFileRecord handles requests to remove a record from a JSON file.
+// The record is removed from the array of records and the file is written back to disk.
+//
+// URL Pattern: /{filename}/{id}
+//
+// On success a 204 No Content response is returned. A 404 Not Found is returned
+// if no record has the specified id.
+//
+// In a singleton, where there are no records, the id names a member of the
+// object and the request is handled by deleteRecordPath, as are PUT and PATCH
+// requests by replaceRecordPath and patchRecordPath.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) deleteFileRecord(w http.ResponseWriter, r *http.Request) {
+	if app.isSingleton(r) {
+		app.deleteRecordPath(w, r)
+		return
+	}
+
+	filename := r.PathValue("filename")
+	id := r.PathValue("id")
+
+	if filename == "" {
+		app.clientError(w, r, http.StatusBadRequest, "Missing file name")
+		return
+	}
+
+	if id == "" {
+		app.clientError(w, r, http.StatusBadRequest, "Missing record ID")
+		return
+	}
+
+	coll, err := app.store.Collection(filename)
+	if err != nil {
+		app.collectionError(w, r, filename, err)
+		return
+	}
+
+	if err := coll.Delete(id); err != nil {
+		app.storeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteFile handles requests to clear a whole collection. By default all records
+// are removed from the file, leaving an empty array; with ?_remove=true the file
+// itself is deleted from the data directory. For a collection naming one array
+// of a file, such as store/products, _remove=true removes only that array and
+// keeps the rest of the file.
+//
+// Deleting collections must be enabled with the -allow-collection-delete flag,
+// otherwise a 405 Method Not Allowed response is returned.
+//
+// URL Pattern: /{filename}
+//
+// On success a 204 No Content response is returned.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) deleteFile(w http.ResponseWriter, r *http.Request) {
+	if !app.allowCollectionDelete {
+		w.Header().Set("Allow", app.allowedMethods(r))
+		app.clientError(w, r, http.StatusMethodNotAllowed, "Deleting collections is disabled")
+		return
+	}
+
+	filename := r.PathValue("filename")
+	if filename == "" {
+		app.clientError(w, r, http.StatusBadRequest, "Missing file name")
+		return
+	}
+
+	var err error
+	if r.URL.Query().Get("_remove") == "true" {
+		err = app.store.Remove(filename)
+	} else {
+		var coll *store.Collection
+		if coll, err = app.store.Collection(filename); err == nil {
+			err = coll.Clear()
 		}
 	}
-	
-	// If no matching record was found, return an empty object
-	if matchedRecord == nil {
-		matchedRecord = make(map[string]interface{})
+	if err != nil {
+		app.collectionError(w, r, filename, fmt.Errorf("error deleting file %s: %w", filename, err))
+		return
 	}
-	
-	// Set content type header
-	w.Header().Set("Content-Type", "application/json")
-	
-	// Send JSON response
-	if err := json.NewEncoder(w).Encode(matchedRecord); err != nil {
-		app.serverError(w, r, fmt.Errorf("error encoding response: %w", err))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getRecordPath handles requests for a value inside a record. The URL path
+// after the record id is a JSON Pointer (RFC 6901) into the record, so
+// /customers/CUST-10058429/address/city returns the city of the customer's
+// address. Array elements are addressed by index, and "~1" and "~0" stand for
+// "/" and "~" in member names.
+//
+// A single segment that is not a field of the record but names a collection
+// is served as a nested route by getChildRecords. In a singleton the whole
+// path, starting with the {id} segment, is a pointer into its object, so
+// /settings/editor/fontSize returns the fontSize member of editor.
+//
+// URL Pattern: /{filename}/{id}/{path...}
+//
+// A 404 Not Found is returned if the record or the path doesn't exist.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) getRecordPath(w http.ResponseWriter, r *http.Request) {
+	filename := r.PathValue("filename")
+	id := r.PathValue("id")
+	tokens := parsePointer(r.PathValue("path"))
+
+	coll, err := app.store.Collection(filename)
+	if err != nil {
+		app.collectionError(w, r, filename, err)
+		return
+	}
+
+	if coll.IsSingleton() {
+		app.getSingletonPath(w, r, coll)
+		return
+	}
+
+	record, ok := coll.Get(id)
+	if !ok {
+		app.clientError(w, r, http.StatusNotFound, fmt.Sprintf("Record with ID %s not found", id))
+		return
+	}
+
+	value, ok := pointerGet(record, tokens)
+	if !ok {
+		if len(tokens) == 1 && app.collectionExists(tokens[0]) {
+			r.SetPathValue("child", tokens[0])
+			app.getChildRecords(w, r)
+			return
+		}
+		app.clientError(w, r, http.StatusNotFound, fmt.Sprintf("Path /%s not found in record %s", r.PathValue("path"), id))
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, value)
+}
+
+// getSingletonPath answers a request for a value inside the object of a
+// singleton, addressed by the {id} and {path} segments of the URL.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - coll: The singleton
+func (app *application) getSingletonPath(w http.ResponseWriter, r *http.Request, coll *store.Collection) {
+	value, ok := pointerGet(coll.Object(), singletonPointer(r))
+	if !ok {
+		app.clientError(w, r, http.StatusNotFound, fmt.Sprintf("Path /%s not found in %s", singletonPath(r), coll.Name()))
+		return
+	}
+
+	projection, err := query.ParseProjection(r.URL.Query())
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if object, ok := value.(map[string]interface{}); ok && projection != nil {
+		value = projection.Apply(object)
+	}
+
+	app.writeJSON(w, r, http.StatusOK, value)
+}
+
+// replaceRecordPath handles requests to set a value inside a record. The
+// request body may be any JSON value and replaces the value the path refers
+// to; a missing member is added to its parent object and "-" appends to an
+// array.
+//
+// URL Pattern: /{filename}/{id}/{path...}
+//
+// On success the new value is returned. A 404 Not Found is returned if the
+// record or the parent of the value doesn't exist.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) replaceRecordPath(w http.ResponseWriter, r *http.Request) {
+	var body interface{}
+	if err := store.DecodeJSON(readBody(r), &body); err != nil {
+		app.clientError(w, r, http.StatusBadRequest, "Request body must be JSON")
+		return
 	}
+
+	record, tokens, ok := app.updateRecordPath(w, r, func(current map[string]interface{}, tokens []string) (interface{}, error) {
+		return pointerSet(current, tokens, body)
+	})
+	if !ok {
+		return
+	}
+
+	// "-" has no value to return; the appended element is the last one
+	if tokens[len(tokens)-1] == "-" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	value, _ := pointerGet(record, tokens)
+	app.writeJSON(w, r, http.StatusOK, value)
 }
 
-// getRecords loads and returns the contents of a JSON file at the specified path.
-// It ensures the file has a .json extension, checks for file existence,
-// and reads the file contents into memory.
+// patchRecordPath handles requests to merge changes into a value inside a
+// record. The request body is applied to the value as a JSON Merge Patch
+// (RFC 7396).
+//
+// URL Pattern: /{filename}/{id}/{path...}
+//
+// On success the updated value is returned. A 404 Not Found is returned if
+// the record or the path doesn't exist.
 //
 // Parameters:
-//   - filepath: The path to the JSON file to read, with or without ".json" extension
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) patchRecordPath(w http.ResponseWriter, r *http.Request) {
+	var body interface{}
+	if err := store.DecodeJSON(readBody(r), &body); err != nil {
+		app.clientError(w, r, http.StatusBadRequest, "Request body must be JSON")
+		return
+	}
+
+	record, tokens, ok := app.updateRecordPath(w, r, func(current map[string]interface{}, tokens []string) (interface{}, error) {
+		existing, ok := pointerGet(current, tokens)
+		if !ok {
+			return nil, errPointerNotFound
+		}
+		return pointerSet(current, tokens, mergePatch(existing, body))
+	})
+	if !ok {
+		return
+	}
+
+	value, _ := pointerGet(record, tokens)
+	app.writeJSON(w, r, http.StatusOK, value)
+}
+
+// deleteRecordPath handles requests to remove a value from a record. Removing
+// an array element shifts the following elements down.
+//
+// URL Pattern: /{filename}/{id}/{path...}
+//
+// On success a 204 No Content response is returned. A 404 Not Found is
+// returned if the record or the path doesn't exist.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) deleteRecordPath(w http.ResponseWriter, r *http.Request) {
+	_, _, ok := app.updateRecordPath(w, r, func(current map[string]interface{}, tokens []string) (interface{}, error) {
+		return pointerRemove(current, tokens)
+	})
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateRecordPath implements the shared flow of writes to a path inside a
+// record: it parses the pointer, computes the new record with change and
+// writes the file back to disk. The record's id can't be changed this way.
+// In a singleton the pointer starts at the {id} segment and is applied to the
+// object itself.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - change: Computes the new record from the current one and the pointer's tokens
 //
 // Returns:
-//   - []byte: The raw file contents if successful
-//   - error: An error if the file doesn't exist, can't be read, or another error occurs
-func getRecords(filepath string) ([]byte, error) {
+//   - map[string]interface{}: The updated record
+//   - []string: The reference tokens of the pointer
+//   - bool: False if the request has already been answered with an error
+func (app *application) updateRecordPath(w http.ResponseWriter, r *http.Request, change func(current map[string]interface{}, tokens []string) (interface{}, error)) (map[string]interface{}, []string, bool) {
+	filename := r.PathValue("filename")
+	id := r.PathValue("id")
 
-	// Enforce .json extension
-	if !strings.HasSuffix(filepath, ".json") {
-		filepath = filepath + ".json"
+	coll, err := app.store.Collection(filename)
+	if err != nil {
+		app.collectionError(w, r, filename, err)
+		return nil, nil, false
 	}
 
+	update := func(current map[string]interface{}, tokens []string) (map[string]interface{}, error) {
+		updated, err := change(current, tokens)
+		if err != nil {
+			return nil, err
+		}
+		return updated.(map[string]interface{}), nil
+	}
 
+	if coll.IsSingleton() {
+		tokens := singletonPointer(r)
+		object, err := coll.Replace(func(current map[string]interface{}) (map[string]interface{}, error) {
+			return update(current, tokens)
+		})
+		if errors.Is(err, errPointerNotFound) {
+			app.clientError(w, r, http.StatusNotFound, fmt.Sprintf("Path /%s not found in %s", singletonPath(r), coll.Name()))
+			return nil, nil, false
+		}
+		if err != nil {
+			app.storeError(w, r, err)
+			return nil, nil, false
+		}
+		return object, tokens, true
+	}
 
-	// Check if the file exists
-	if _, err := os.Stat(filepath); os.IsNotExist(err) {
-		return nil, err
+	tokens := parsePointer(r.PathValue("path"))
+	if slices.Contains(coll.IDFields(), tokens[0]) {
+		app.clientError(w, r, http.StatusBadRequest, "Record ID can't be changed")
+		return nil, nil, false
 	}
 
-	fileContent, err := os.ReadFile(filepath)
+	record, err := coll.Update(id, func(current map[string]interface{}) (map[string]interface{}, error) {
+		return update(current, tokens)
+	})
+	if errors.Is(err, errPointerNotFound) {
+		app.clientError(w, r, http.StatusNotFound, fmt.Sprintf("Path /%s not found in record %s", r.PathValue("path"), id))
+		return nil, nil, false
+	}
 	if err != nil {
-		return nil, err
+		app.storeError(w, r, err)
+		return nil, nil, false
 	}
-	return fileContent, nil 
+	return record, tokens, true
+}
+
+// isSingleton reports whether the {filename} of a request names a singleton.
+// Errors loading the collection are left to the handler to report.
+func (app *application) isSingleton(r *http.Request) bool {
+	coll, err := app.store.Collection(r.PathValue("filename"))
+	return err == nil && coll.IsSingleton()
 }
 
+// singletonPath returns the path of a request to a singleton after the file
+// name, such as "editor/fontSize" for /settings/editor/fontSize.
+func singletonPath(r *http.Request) string {
+	if path := r.PathValue("path"); path != "" {
+		return r.PathValue("id") + "/" + path
+	}
+	return r.PathValue("id")
+}
+
+// singletonPointer returns the reference tokens of the JSON Pointer that a
+// request to a singleton addresses inside its object.
+func singletonPointer(r *http.Request) []string {
+	return parsePointer(singletonPath(r))
+}
+
+// allowedMethods returns the Allow header for the URL of a request, as sent
+// with OPTIONS responses and every 405 Method Not Allowed. The methods follow
+// the routes: a collection, /{filename}, takes GET and POST, and a singleton
+// GET, PUT and PATCH, both with DELETE if collection deletes are enabled.
+// Records and paths inside them take GET, PUT, PATCH and DELETE, and
+// /{filename}/{id}/{child} takes POST too. GET routes also answer HEAD.
+//
+// Parameters:
+//   - r: The HTTP request, after subCollections has joined a file and array name
+//
+// Returns:
+//   - string: The comma-separated methods
+func (app *application) allowedMethods(r *http.Request) string {
+	segments := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+
+	var methods []string
+	switch {
+	case len(segments) == 1 && segments[0] == "":
+		methods = []string{"GET", "HEAD"}
+	case len(segments) == 1:
+		methods = []string{"GET", "HEAD", "POST"}
+		name, err := url.PathUnescape(segments[0])
+		if err == nil {
+			if coll, err := app.store.Collection(name); err == nil && coll.IsSingleton() {
+				methods = []string{"GET", "HEAD", "PUT", "PATCH"}
+			}
+		}
+		if app.allowCollectionDelete {
+			methods = append(methods, "DELETE")
+		}
+	case len(segments) == 3:
+		methods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+	default:
+		methods = []string{"GET", "HEAD", "PUT", "PATCH", "DELETE"}
+	}
+	return strings.Join(append(methods, "OPTIONS"), ", ")
+}
+
+// options handles OPTIONS requests with a 204 No Content listing the methods
+// the URL supports in an Allow header; see allowedMethods.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+func (app *application) options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", app.allowedMethods(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storeError responds to an error returned by a store write. Missing records
+// and duplicate ids are reported to the client, as are record operations on
+// singletons; anything else is a server error.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - err: The error returned by the store
+func (app *application) storeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrRecordNotFound):
+		app.clientError(w, r, http.StatusNotFound, fmt.Sprintf("Record with ID %s not found", r.PathValue("id")))
+	case errors.Is(err, store.ErrDuplicateID):
+		app.clientError(w, r, http.StatusConflict, "A record with this ID already exists")
+	case errors.Is(err, store.ErrMissingID):
+		app.clientError(w, r, http.StatusBadRequest, "Record must have a value for each of its ID fields")
+	case errors.Is(err, store.ErrSingleton):
+		w.Header().Set("Allow", app.allowedMethods(r))
+		app.clientError(w, r, http.StatusMethodNotAllowed, fmt.Sprintf("%s is a single object, not a collection", r.PathValue("filename")))
+	default:
+		app.serverError(w, r, err)
+	}
+}
+
+// relationError responds to an error resolving the relations requested by
+// _expand or _embed. Unknown relations are the client's mistake; anything
+// else is a server error.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - err: The error returned by relationExpander
+func (app *application) relationError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errUnknownRelation) {
+		app.clientError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	app.serverError(w, r, err)
+}
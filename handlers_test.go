@@ -0,0 +1,1091 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RAshkettle/getter/internal/files"
+	"github.com/RAshkettle/getter/internal/store"
+)
+
+// testProducts is the content of the products.json file used by the handler tests
+const testProducts = `{
+  "products": [
+    {"id": 1, "title": "Ultra Slim Laptop Pro", "price": 1299.99},
+    {"id": 2, "title": "Artisan Coffee Maker", "price": 149.95}
+  ]
+}`
+
+// testCustomers is the content of the customers.json file used by the handler tests
+const testCustomers = `{
+  "customers": [
+    {
+      "id": "CUST-10058429",
+      "firstName": "Emily",
+      "address": {"city": "Portland", "state": "OR"}
+    }
+  ]
+}`
+
+// newTestApp creates an application serving a temporary data directory
+// populated with the given files, keyed by filename.
+func newTestApp(t *testing.T, dataFiles map[string]string) *application {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	for name, content := range dataFiles {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write test file %s: %v", name, err)
+		}
+	}
+
+	return &application{
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		dataPath: tempDir,
+		store:    store.New(tempDir),
+	}
+}
+
+// readTestRecords reads the array of records stored under key in a data file
+func readTestRecords(t *testing.T, app *application, filename, key string) []map[string]interface{} {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join(app.dataPath, filename))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", filename, err)
+	}
+
+	var data map[string][]map[string]interface{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		t.Fatalf("Failed to parse %s: %v", filename, err)
+	}
+	return data[key]
+}
+
+// TestCreateFileRecord tests adding records through POST /{filename}
+func TestCreateFileRecord(t *testing.T) {
+	tests := []struct {
+		name             string
+		url              string
+		body             string
+		expectedStatus   int
+		expectedLocation string
+		expectedCount    int
+	}{
+		{
+			name:             "Numeric id",
+			url:              "/products",
+			body:             `{"id": 3, "title": "SmartLife Fitness Watch", "price": 89.99}`,
+			expectedStatus:   http.StatusCreated,
+			expectedLocation: "/products/3",
+			expectedCount:    3,
+		},
+		{
+			name:             "String id",
+			url:              "/products",
+			body:             `{"id": "TECH-LP001", "title": "Docking Station"}`,
+			expectedStatus:   http.StatusCreated,
+			expectedLocation: "/products/TECH-LP001",
+			expectedCount:    3,
+		},
+		{
+			name:           "Duplicate id",
+			url:            "/products",
+			body:           `{"id": 1, "title": "Duplicate"}`,
+			expectedStatus: http.StatusConflict,
+			expectedCount:  2,
+		},
+		{
+			name:           "Body is not an object",
+			url:            "/products",
+			body:           `[1, 2, 3]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCount:  2,
+		},
+		{
+			name:           "Invalid JSON",
+			url:            "/products",
+			body:           `{"id": 4,`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCount:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, map[string]string{"products.json": testProducts})
+
+			r := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d (body %q)", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if location := w.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("Expected Location %q, got %q", tt.expectedLocation, location)
+			}
+
+			records := readTestRecords(t, app, "products.json", "products")
+			if len(records) != tt.expectedCount {
+				t.Errorf("Expected %d records on disk, got %d", tt.expectedCount, len(records))
+			}
+		})
+	}
+}
+
+// TestCreateFileRecordPreservesFile tests that writing a record keeps the
+// existing values and formatting of the data file intact
+func TestCreateFileRecordPreservesFile(t *testing.T) {
+	app := newTestApp(t, map[string]string{"products.json": `{"products": [{"id": 1, "imageUrl": "https://example.com/a.jpg?w=800&q=80", "price": 1299.99}]}`})
+
+	r := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"id": 2}`))
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	content, err := os.ReadFile(filepath.Join(app.dataPath, "products.json"))
+	if err != nil {
+		t.Fatalf("Failed to read products.json: %v", err)
+	}
+
+	for _, expected := range []string{`"price": 1299.99`, `w=800&q=80`, "\n    {\n"} {
+		if !bytes.Contains(content, []byte(expected)) {
+			t.Errorf("Expected file to contain %q, got:\n%s", expected, content)
+		}
+	}
+}
+
+// TestUpdateFileRecord tests replacing and merging records through PUT and PATCH
+func TestUpdateFileRecord(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		expectedStatus int
+		expected       map[string]interface{}
+	}{
+		{
+			name:           "PUT replaces the record",
+			method:         http.MethodPut,
+			url:            "/customers/CUST-10058429",
+			body:           `{"firstName": "Emma"}`,
+			expectedStatus: http.StatusOK,
+			expected:       map[string]interface{}{"id": "CUST-10058429", "firstName": "Emma"},
+		},
+		{
+			name:           "PATCH merges nested objects",
+			method:         http.MethodPatch,
+			url:            "/customers/CUST-10058429",
+			body:           `{"address": {"city": "Salem", "state": null}}`,
+			expectedStatus: http.StatusOK,
+			expected: map[string]interface{}{
+				"id":        "CUST-10058429",
+				"firstName": "Emily",
+				"address":   map[string]interface{}{"city": "Salem"},
+			},
+		},
+		{
+			name:           "PATCH keeps numeric ids",
+			method:         http.MethodPatch,
+			url:            "/products/2",
+			body:           `{"price": 139.95}`,
+			expectedStatus: http.StatusOK,
+			expected:       map[string]interface{}{"id": float64(2), "title": "Artisan Coffee Maker", "price": 139.95},
+		},
+		{
+			name:           "Missing id",
+			method:         http.MethodPut,
+			url:            "/customers/CUST-00000000",
+			body:           `{"firstName": "Nobody"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Mismatched id in body",
+			method:         http.MethodPatch,
+			url:            "/products/2",
+			body:           `{"id": 7}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid body",
+			method:         http.MethodPut,
+			url:            "/products/2",
+			body:           `"title"`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, map[string]string{
+				"products.json":  testProducts,
+				"customers.json": testCustomers,
+			})
+
+			r := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d (body %q)", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expected == nil {
+				return
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected response %v, got %v", tt.expected, got)
+			}
+
+			// The change must also be written to disk
+			parts := strings.Split(tt.url, "/")
+			for _, record := range readTestRecords(t, app, parts[1]+".json", parts[1]) {
+				if fmt.Sprintf("%v", record["id"]) == parts[2] && !reflect.DeepEqual(record, tt.expected) {
+					t.Errorf("Expected record on disk %v, got %v", tt.expected, record)
+				}
+			}
+		})
+	}
+}
+
+// TestDeleteFileRecord tests removing records through DELETE /{filename}/{id}
+func TestDeleteFileRecord(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{
+			name:           "Existing record",
+			url:            "/products/1",
+			expectedStatus: http.StatusNoContent,
+			expectedCount:  1,
+		},
+		{
+			name:           "Missing record",
+			url:            "/products/9",
+			expectedStatus: http.StatusNotFound,
+			expectedCount:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, map[string]string{"products.json": testProducts})
+
+			r := httptest.NewRequest(http.MethodDelete, tt.url, nil)
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d (body %q)", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			records := readTestRecords(t, app, "products.json", "products")
+			if len(records) != tt.expectedCount {
+				t.Errorf("Expected %d records on disk, got %d", tt.expectedCount, len(records))
+			}
+		})
+	}
+}
+
+// TestDeleteFile tests clearing whole collections through DELETE /{filename}
+func TestDeleteFile(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowed        bool
+		url            string
+		expectedStatus int
+		expectedExists bool
+		expectedCount  int
+	}{
+		{
+			name:           "Disabled by default",
+			url:            "/products",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedExists: true,
+			expectedCount:  2,
+		},
+		{
+			name:           "Empties the collection",
+			allowed:        true,
+			url:            "/products",
+			expectedStatus: http.StatusNoContent,
+			expectedExists: true,
+			expectedCount:  0,
+		},
+		{
+			name:           "Removes the file",
+			allowed:        true,
+			url:            "/products?_remove=true",
+			expectedStatus: http.StatusNoContent,
+			expectedExists: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, map[string]string{"products.json": testProducts})
+			app.allowCollectionDelete = tt.allowed
+
+			r := httptest.NewRequest(http.MethodDelete, tt.url, nil)
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d (body %q)", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			_, err := os.Stat(filepath.Join(app.dataPath, "products.json"))
+			if exists := err == nil; exists != tt.expectedExists {
+				t.Fatalf("Expected file to exist: %v, got %v", tt.expectedExists, exists)
+			}
+
+			if tt.expectedExists {
+				records := readTestRecords(t, app, "products.json", "products")
+				if len(records) != tt.expectedCount {
+					t.Errorf("Expected %d records on disk, got %d", tt.expectedCount, len(records))
+				}
+			}
+		})
+	}
+}
+
+// TestCreateFileRecordGeneratesID tests that records posted without an id get one
+func TestCreateFileRecordGeneratesID(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		strategy string
+		pattern  string
+	}{
+		{
+			name:    "Next integer for numeric ids",
+			url:     "/products",
+			pattern: `^/products/3$`,
+		},
+		{
+			name:    "Matching pattern for prefixed ids",
+			url:     "/customers",
+			pattern: `^/customers/CUST-\d{8}$`,
+		},
+		{
+			name:     "Configured strategy",
+			url:      "/products",
+			strategy: "uuid4",
+			pattern:  `^/products/[0-9a-f-]{36}$`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, map[string]string{
+				"products.json":  testProducts,
+				"customers.json": testCustomers,
+			})
+			if tt.strategy != "" {
+				generators, err := parseIDStrategies(collectionSettings{"products": tt.strategy})
+				if err != nil {
+					t.Fatalf("Failed to parse strategy: %v", err)
+				}
+				app.idGenerators = generators
+			}
+
+			r := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(`{"title": "New"}`))
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, r)
+
+			if w.Code != http.StatusCreated {
+				t.Fatalf("Expected status code %d, got %d (body %q)", http.StatusCreated, w.Code, w.Body.String())
+			}
+
+			location := w.Header().Get("Location")
+			if !regexp.MustCompile(tt.pattern).MatchString(location) {
+				t.Errorf("Expected Location matching %s, got %q", tt.pattern, location)
+			}
+		})
+	}
+}
+
+// TestGetFileRecordsFiltering tests filtering collections through the query string
+func TestGetFileRecordsFiltering(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"products.json":  testProducts,
+		"customers.json": testCustomers,
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		key      string
+		expected []string
+	}{
+		{name: "All records", url: "/products", key: "products", expected: []string{"1", "2"}},
+		{name: "Numeric id", url: "/products?id=1", key: "products", expected: []string{"1"}},
+		{name: "String id", url: "/customers?id=CUST-10058429", key: "customers", expected: []string{"CUST-10058429"}},
+		{name: "Nested field", url: "/customers?address.state=OR", key: "customers", expected: []string{"CUST-10058429"}},
+		{name: "Repeated key", url: "/products?title=Artisan+Coffee+Maker&title=Ultra+Slim+Laptop+Pro", key: "products", expected: []string{"1", "2"}},
+		{name: "No match", url: "/customers?address.state=TX", key: "customers", expected: []string{}},
+		{name: "Operator", url: "/products?price_lt=500", key: "products", expected: []string{"2"}},
+		{name: "Sorted descending", url: "/products?_sort=-price", key: "products", expected: []string{"1", "2"}},
+		{name: "Sorted by title", url: "/products?_sort=title", key: "products", expected: []string{"2", "1"}},
+		{name: "Search", url: "/products?q=coffee", key: "products", expected: []string{"2"}},
+		{name: "Search nested values", url: "/customers?q=PORTLAND", key: "customers", expected: []string{"CUST-10058429"}},
+		{name: "Tokenized search", url: "/products?q=laptop+ultra&_tokenize=true", key: "products", expected: []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+			}
+
+			var data map[string][]map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+
+			got := []string{}
+			for _, record := range data[tt.key] {
+				got = append(got, fmt.Sprintf("%v", record["id"]))
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected ids %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestGetFileRecordsPagination tests paging through collections with the
+// X-Total-Count and Link headers
+func TestGetFileRecordsPagination(t *testing.T) {
+	app := newTestApp(t, map[string]string{"products.json": testProducts})
+
+	tests := []struct {
+		name     string
+		url      string
+		expected []string
+		link     string
+	}{
+		{name: "Unpaginated", url: "/products", expected: []string{"1", "2"}},
+		{
+			name:     "Second page",
+			url:      "/products?_page=2&_limit=1",
+			expected: []string{"2"},
+			link:     `<http://example.com/products?_limit=1&_page=1>; rel="first", <http://example.com/products?_limit=1&_page=1>; rel="prev", <http://example.com/products?_limit=1&_page=2>; rel="last"`,
+		},
+		{
+			name:     "Offset",
+			url:      "/products?_start=0&_end=1&_sort=-id",
+			expected: []string{"2"},
+			link:     `<http://example.com/products?_end=1&_sort=-id&_start=0>; rel="first", <http://example.com/products?_end=2&_sort=-id&_start=1>; rel="next", <http://example.com/products?_end=2&_sort=-id&_start=1>; rel="last"`,
+		},
+		{name: "Beyond the last page", url: "/products?_page=5&_limit=1", expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+			}
+
+			if got := w.Header().Get("X-Total-Count"); got != "2" {
+				t.Errorf("Expected X-Total-Count 2, got %q", got)
+			}
+
+			if tt.link != "" {
+				if got := w.Header().Get("Link"); got != tt.link {
+					t.Errorf("Expected Link\n%s\ngot\n%s", tt.link, got)
+				}
+			}
+
+			var data map[string][]map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+
+			got := []string{}
+			for _, record := range data["products"] {
+				got = append(got, fmt.Sprintf("%v", record["id"]))
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected ids %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestGetFileRecordsCursor tests following next cursors through a collection
+func TestGetFileRecordsCursor(t *testing.T) {
+	app := newTestApp(t, map[string]string{"products.json": testProducts})
+
+	var got []string
+	next := ""
+	for range 3 {
+		w := httptest.NewRecorder()
+		target := "/products?_sort=-price&_limit=1&_cursor=" + url.QueryEscape(next)
+		app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var data map[string][]map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		for _, record := range data["products"] {
+			got = append(got, fmt.Sprintf("%v", record["id"]))
+		}
+
+		next = w.Header().Get("X-Next-Cursor")
+		if next == "" {
+			break
+		}
+		if link := w.Header().Get("Link"); !strings.Contains(link, `rel="next"`) {
+			t.Errorf("Expected a next link, got %q", link)
+		}
+	}
+
+	if expected := []string{"1", "2"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected ids %v, got %v", expected, got)
+	}
+	if next != "" {
+		t.Errorf("Expected no cursor after the last page, got %q", next)
+	}
+}
+
+// TestGetFileRecordsProjection tests selecting fields with _fields and _exclude
+func TestGetFileRecordsProjection(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"products.json":  testProducts,
+		"customers.json": testCustomers,
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{name: "Collection fields", url: "/products?_fields=id,title&price_lt=500", expected: `{"products":[{"id":2,"title":"Artisan Coffee Maker"}]}`},
+		{name: "Collection exclude", url: "/products?_exclude=title&_sort=price", expected: `{"products":[{"id":2,"price":149.95},{"id":1,"price":1299.99}]}`},
+		{name: "Record nested field", url: "/customers/CUST-10058429?_fields=firstName,address.city", expected: `{"address":{"city":"Portland"},"firstName":"Emily"}`},
+		{name: "Record exclude", url: "/customers/CUST-10058429?_exclude=address,firstName", expected: `{"id":"CUST-10058429"}`},
+		{name: "Search highlight", url: "/customers?q=portland&_highlight=true&_fields=id", expected: `{"customers":[{"_highlight":["address.city"],"id":"CUST-10058429"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+			}
+
+			var got bytes.Buffer
+			if err := json.Compact(&got, w.Body.Bytes()); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if got.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got.String())
+			}
+		})
+	}
+
+	// The stored records keep all their fields
+	if records := readTestRecords(t, app, "customers.json", "customers"); records[0]["address"] == nil {
+		t.Error("Expected the stored record to be unchanged")
+	}
+}
+
+// TestRecordPaths tests reading and writing values inside records through
+// JSON Pointer sub-paths
+func TestRecordPaths(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"customers.json": testCustomers,
+		"orders.json":    `{"orders": [{"id": 1, "customerId": "CUST-10058429"}]}`,
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		status   int
+		expected string
+	}{
+		{name: "Get object", method: http.MethodGet, url: "/customers/CUST-10058429/address", status: http.StatusOK, expected: `{"city":"Portland","state":"OR"}`},
+		{name: "Get nested value", method: http.MethodGet, url: "/customers/CUST-10058429/address/city", status: http.StatusOK, expected: `"Portland"`},
+		{name: "Get missing path", method: http.MethodGet, url: "/customers/CUST-10058429/address/zip", status: http.StatusNotFound},
+		{name: "Get missing record", method: http.MethodGet, url: "/customers/CUST-1/address", status: http.StatusNotFound},
+		{name: "Child collection", method: http.MethodGet, url: "/customers/CUST-10058429/orders?_fields=id", status: http.StatusOK, expected: `{"orders":[{"id":1}]}`},
+		{name: "Put value", method: http.MethodPut, url: "/customers/CUST-10058429/address/city", body: `"Salem"`, status: http.StatusOK, expected: `"Salem"`},
+		{name: "Put new member", method: http.MethodPut, url: "/customers/CUST-10058429/tags", body: `["vip"]`, status: http.StatusOK, expected: `["vip"]`},
+		{name: "Append element", method: http.MethodPut, url: "/customers/CUST-10058429/tags/-", body: `"new"`, status: http.StatusOK, expected: `["vip","new"]`},
+		{name: "Put under missing parent", method: http.MethodPut, url: "/customers/CUST-10058429/phone/home", body: `"555"`, status: http.StatusNotFound},
+		{name: "Patch object", method: http.MethodPatch, url: "/customers/CUST-10058429/address", body: `{"zip":"97301","state":null}`, status: http.StatusOK, expected: `{"city":"Salem","zip":"97301"}`},
+		{name: "Patch missing path", method: http.MethodPatch, url: "/customers/CUST-10058429/phone", body: `{}`, status: http.StatusNotFound},
+		{name: "Delete value", method: http.MethodDelete, url: "/customers/CUST-10058429/tags/0", status: http.StatusNoContent},
+		{name: "Delete missing path", method: http.MethodDelete, url: "/customers/CUST-10058429/phone", status: http.StatusNotFound},
+		{name: "Change id", method: http.MethodPut, url: "/customers/CUST-10058429/id", body: `"CUST-2"`, status: http.StatusBadRequest},
+		{name: "Invalid body", method: http.MethodPut, url: "/customers/CUST-10058429/address", body: `{`, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.expected == "" {
+				return
+			}
+
+			var got bytes.Buffer
+			if err := json.Compact(&got, w.Body.Bytes()); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if got.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got.String())
+			}
+		})
+	}
+
+	// The changes are written to the file
+	records := readTestRecords(t, app, "customers.json", "customers")
+	expected := map[string]interface{}{
+		"id":        "CUST-10058429",
+		"firstName": "Emily",
+		"address":   map[string]interface{}{"city": "Salem", "zip": "97301"},
+		"tags":      []interface{}{"new"},
+	}
+	if !reflect.DeepEqual(records[0], expected) {
+		t.Errorf("Expected stored record %v, got %v", expected, records[0])
+	}
+}
+
+// TestSingletons tests files holding a single object, which are read and
+// updated as a whole or through sub-paths
+func TestSingletons(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"settings.json":  `{"theme": "dark", "editor": {"fontSize": 12, "tabs": true}, "languages": ["en"]}`,
+		"customers.json": testCustomers,
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		status   int
+		allow    string
+		expected string
+	}{
+		{name: "Get object", method: http.MethodGet, url: "/settings?_fields=theme", status: http.StatusOK, expected: `{"theme":"dark"}`},
+		{name: "Get member", method: http.MethodGet, url: "/settings/theme", status: http.StatusOK, expected: `"dark"`},
+		{name: "Get nested member", method: http.MethodGet, url: "/settings/editor/fontSize", status: http.StatusOK, expected: `12`},
+		{name: "Get array element", method: http.MethodGet, url: "/settings/languages/0", status: http.StatusOK, expected: `"en"`},
+		{name: "Get missing member", method: http.MethodGet, url: "/settings/font", status: http.StatusNotFound},
+		{name: "Patch object", method: http.MethodPatch, url: "/settings", body: `{"theme":"light","editor":{"tabs":null}}`, status: http.StatusOK, expected: `{"editor":{"fontSize":12},"languages":["en"],"theme":"light"}`},
+		{name: "Put member", method: http.MethodPut, url: "/settings/theme", body: `"solarized"`, status: http.StatusOK, expected: `"solarized"`},
+		{name: "Patch member", method: http.MethodPatch, url: "/settings/editor", body: `{"fontSize":14}`, status: http.StatusOK, expected: `{"fontSize":14}`},
+		{name: "Append element", method: http.MethodPut, url: "/settings/languages/-", body: `"fr"`, status: http.StatusOK, expected: `["en","fr"]`},
+		{name: "Delete member", method: http.MethodDelete, url: "/settings/languages", status: http.StatusNoContent},
+		{name: "Delete missing member", method: http.MethodDelete, url: "/settings/languages", status: http.StatusNotFound},
+		{name: "Put object", method: http.MethodPut, url: "/settings", body: `{"theme":"light","editor":{"fontSize":14}}`, status: http.StatusOK, expected: `{"editor":{"fontSize":14},"theme":"light"}`},
+		{name: "Put non-object", method: http.MethodPut, url: "/settings", body: `[1]`, status: http.StatusBadRequest},
+		{name: "Post to singleton", method: http.MethodPost, url: "/settings", body: `{"id":1}`, status: http.StatusMethodNotAllowed, allow: "GET, HEAD, PUT, PATCH, OPTIONS"},
+		{name: "Put collection", method: http.MethodPut, url: "/customers", body: `{}`, status: http.StatusMethodNotAllowed, allow: "GET, HEAD, POST, OPTIONS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.allow {
+				t.Errorf("Expected Allow header %q, got %q", tt.allow, allow)
+			}
+			if tt.expected == "" {
+				return
+			}
+
+			var got bytes.Buffer
+			if err := json.Compact(&got, w.Body.Bytes()); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if got.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got.String())
+			}
+		})
+	}
+
+	// The file keeps holding the object
+	content, err := os.ReadFile(filepath.Join(app.dataPath, "settings.json"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	var stored map[string]interface{}
+	if err := json.Unmarshal(content, &stored); err != nil || stored["theme"] != "light" {
+		t.Errorf("Unexpected file content %s", content)
+	}
+}
+
+// TestIDFields tests collections identified by a configured id field or a
+// composite key
+func TestIDFields(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"products.json":   `{"products": [{"sku": "A-1", "title": "Lamp"}, {"sku": "B-2", "title": "Desk"}]}`,
+		"orderLines.json": `{"orderLines": [{"orderId": 1001, "lineNo": 1, "sku": "A-1"}, {"orderId": 1001, "lineNo": 2, "sku": "B-2"}]}`,
+	})
+	app.store.SetIDFields("products", []string{"sku"})
+	app.store.SetIDFields("orderLines", []string{"orderId", "lineNo"})
+	app.relations = []relation{{child: "orderLines", field: "sku", parent: "products"}}
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		status   int
+		expected string
+	}{
+		{name: "Get by id field", method: http.MethodGet, url: "/products/B-2", status: http.StatusOK, expected: `{"sku":"B-2","title":"Desk"}`},
+		{name: "Get by composite key", method: http.MethodGet, url: "/orderLines/1001,2?_fields=sku", status: http.StatusOK, expected: `{"sku":"B-2"}`},
+		{name: "Expand", method: http.MethodGet, url: "/orderLines/1001,1?_expand=product&_fields=product.title", status: http.StatusOK, expected: `{"product":{"title":"Lamp"}}`},
+		{name: "Embed", method: http.MethodGet, url: "/products/A-1?_embed=orderLines&_fields=orderLines", status: http.StatusOK, expected: `{"orderLines":[{"lineNo":1,"orderId":1001,"sku":"A-1"}]}`},
+		{name: "Nested route", method: http.MethodGet, url: "/products/B-2/orderLines?_fields=lineNo", status: http.StatusOK, expected: `{"orderLines":[{"lineNo":2}]}`},
+		{name: "Cursor", method: http.MethodGet, url: "/orderLines?_cursor=&_limit=1&_sort=-orderId&_fields=lineNo", status: http.StatusOK, expected: `{"orderLines":[{"lineNo":1}]}`},
+		{name: "Patch", method: http.MethodPatch, url: "/products/A-1", body: `{"title":"Floor lamp"}`, status: http.StatusOK, expected: `{"sku":"A-1","title":"Floor lamp"}`},
+		{name: "Change id field", method: http.MethodPut, url: "/products/A-1", body: `{"sku":"C-3"}`, status: http.StatusBadRequest},
+		{name: "Change part of key", method: http.MethodPatch, url: "/orderLines/1001,1", body: `{"lineNo":3}`, status: http.StatusBadRequest},
+		{name: "Change id field by path", method: http.MethodPut, url: "/orderLines/1001,1/lineNo", body: `3`, status: http.StatusBadRequest},
+		{name: "Post without key", method: http.MethodPost, url: "/orderLines", body: `{"orderId":1002}`, status: http.StatusBadRequest},
+		{name: "Post with key", method: http.MethodPost, url: "/orderLines", body: `{"orderId":1002,"lineNo":1}`, status: http.StatusCreated, expected: `{"lineNo":1,"orderId":1002}`},
+		{name: "Delete by composite key", method: http.MethodDelete, url: "/orderLines/1001,2", status: http.StatusNoContent},
+		{name: "Deleted", method: http.MethodGet, url: "/orderLines/1001,2/sku", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.method == http.MethodPost && tt.status == http.StatusCreated {
+				if location := w.Header().Get("Location"); location != "/orderLines/1002,1" {
+					t.Errorf("Expected Location /orderLines/1002,1, got %q", location)
+				}
+			}
+			if tt.expected == "" {
+				return
+			}
+
+			var got bytes.Buffer
+			if err := json.Compact(&got, w.Body.Bytes()); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if got.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got.String())
+			}
+		})
+	}
+}
+
+// TestYAMLCollections tests serving YAML files like JSON ones and listing
+// each file's format
+func TestYAMLCollections(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"customers.yml": "customers:\n  - id: 1\n    firstName: Emily\n",
+		"products.json": testProducts,
+		"notes.txt":     "not data",
+		"orders.YAML":   "- id: 1\n  total: 12.5\n",
+	})
+
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/customers/1", nil))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "{\n  \"firstName\": \"Emily\",\n  \"id\": 1\n}" {
+		t.Errorf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/customers/1", strings.NewReader(`{"firstName": "Emma"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", w.Code, w.Body.String())
+	}
+	content, _ := os.ReadFile(filepath.Join(app.dataPath, "customers.yml"))
+	if string(content) != "customers:\n  - firstName: Emma\n    id: 1\n" {
+		t.Errorf("Expected the change to be written as YAML, got:\n%s", content)
+	}
+
+	w = httptest.NewRecorder()
+	app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var home struct {
+		Files []files.File `json:"files"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &home); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	expected := map[string]string{"customers.yml": "yaml", "products.json": "json", "notes.txt": "", "orders.YAML": "yaml"}
+	if len(home.Files) != len(expected) {
+		t.Fatalf("Expected %d files, got %v", len(expected), home.Files)
+	}
+	for _, file := range home.Files {
+		if format, ok := expected[file.Name]; !ok || file.Format != format {
+			t.Errorf("Expected format %q for %s, got %q", format, file.Name, file.Format)
+		}
+	}
+
+	// A listed file is served whatever the case of its extension
+	for _, url := range []string{"/orders", "/orders.YAML/1", "/orders.yaml/1"} {
+		w = httptest.NewRecorder()
+		app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total": 12.5`) {
+			t.Errorf("Unexpected response for %s %d: %s", url, w.Code, w.Body.String())
+		}
+	}
+	w = httptest.NewRecorder()
+	app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"total": 3}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code 201, got %d: %s", w.Code, w.Body.String())
+	}
+	content, _ = os.ReadFile(filepath.Join(app.dataPath, "orders.YAML"))
+	if string(content) != "- id: 1\n  total: 12.5\n- id: 2\n  total: 3\n" {
+		t.Errorf("Expected the record to be written to orders.YAML, got:\n%s", content)
+	}
+}
+
+// TestNDJSONCollections tests that NDJSON collections are streamed and
+// appended to
+func TestNDJSONCollections(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"events.ndjson": "{\"id\": 1, \"type\": \"click\", \"page\": \"/\"}\n{\"id\": 2, \"type\": \"view\", \"page\": \"/a&b\"}\n",
+		"empty.jsonl":   "",
+		"broken.ndjson": "not json\n{\"id\": 1}\n",
+		"torn.ndjson":   "{\"id\": 1}\n{\"id\": 2, \"ty",
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		status   int
+		expected string
+		total    string
+	}{
+		{name: "Streamed", url: "/events", status: http.StatusOK, expected: "[\n  {\n    \"id\": 1,\n    \"page\": \"/\",\n    \"type\": \"click\"\n  },\n  {\n    \"id\": 2,\n    \"page\": \"/a&b\",\n    \"type\": \"view\"\n  }\n]\n"},
+		{name: "Streamed with filter and fields", url: "/events?type=view&_fields=page", status: http.StatusOK, expected: "[\n  {\n    \"page\": \"/a&b\"\n  }\n]\n"},
+		{name: "Streamed without matches", url: "/events?type=scroll", status: http.StatusOK, expected: "[]\n"},
+		{name: "Empty file", url: "/empty", status: http.StatusOK, expected: "[]\n"},
+		{name: "Sorted from memory", url: "/events?_sort=-id&_fields=id", status: http.StatusOK, expected: "[\n  {\n    \"id\": 2\n  },\n  {\n    \"id\": 1\n  }\n]\n", total: "2"},
+		{name: "Record", url: "/events/2?_fields=type", status: http.StatusOK, expected: "{\n  \"type\": \"view\"\n}\n"},
+		{name: "Invalid file", url: "/broken", status: http.StatusInternalServerError},
+		{name: "Torn last line streamed", url: "/torn?_format=ndjson", status: http.StatusOK, expected: "{\"id\":1}\n"},
+		{name: "Torn last line loaded", url: "/torn/1", status: http.StatusOK, expected: "{\n  \"id\": 1\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.expected != "" && w.Body.String() != tt.expected {
+				t.Errorf("Expected body:\n%s\ngot:\n%s", tt.expected, w.Body.String())
+			}
+			if total := w.Header().Get("X-Total-Count"); total != tt.total {
+				t.Errorf("Expected X-Total-Count %q, got %q", tt.total, total)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{"type": "scroll"}`)))
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/events/3" {
+		t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	content, _ := os.ReadFile(filepath.Join(app.dataPath, "events.ndjson"))
+	if !strings.HasSuffix(string(content), "\"page\": \"/a&b\"}\n{\"id\":3,\"type\":\"scroll\"}\n") {
+		t.Errorf("Expected the record to be appended as a line, got:\n%s", content)
+	}
+
+	w = httptest.NewRecorder()
+	app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/torn", strings.NewReader(`{"type": "scroll"}`)))
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/torn/2" {
+		t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	content, _ = os.ReadFile(filepath.Join(app.dataPath, "torn.ndjson"))
+	if string(content) != "{\"id\": 1}\n{\"id\":2,\"type\":\"scroll\"}\n" {
+		t.Errorf("Expected the torn line to be replaced, got:\n%s", content)
+	}
+}
+
+// TestStreamWriteTimeout tests that a streamed response isn't cut off by the
+// server's write timeout when the client reads it slowly
+func TestStreamWriteTimeout(t *testing.T) {
+	var sb strings.Builder
+	for i := 1; i <= 100_000; i++ {
+		fmt.Fprintf(&sb, "{\"id\": %d, \"type\": \"click\", \"page\": \"/products/%d\"}\n", i, i)
+	}
+	app := newTestApp(t, map[string]string{"events.ndjson": sb.String()})
+
+	srv := httptest.NewUnstartedServer(app.routes())
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events?_format=ndjson")
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Fall behind so the server blocks on writes past its deadline
+	time.Sleep(200 * time.Millisecond)
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Reading the response error = %v", err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != 100_000 {
+		t.Errorf("Expected 100000 records, got %d", lines)
+	}
+}
+
+// TestSubCollections tests files holding a top-level array or several arrays
+func TestSubCollections(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"events.json": `[{"id": 1, "type": "click"}, {"id": 2, "type": "view"}]`,
+		"store.json":  `{"products": [{"id": 1, "title": "Lamp"}], "categories": [{"id": 1, "name": "Lighting"}]}`,
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		status   int
+		expected string
+		location string
+	}{
+		{name: "Top-level array", method: http.MethodGet, url: "/events?type=view", status: http.StatusOK, expected: `[{"id":2,"type":"view"}]`},
+		{name: "Top-level array record", method: http.MethodGet, url: "/events/1", status: http.StatusOK, expected: `{"id":1,"type":"click"}`},
+		{name: "Sub-collection", method: http.MethodGet, url: "/store/products", status: http.StatusOK, expected: `[{"id":1,"title":"Lamp"}]`},
+		{name: "Other sub-collection", method: http.MethodGet, url: "/store/categories?_fields=name", status: http.StatusOK, expected: `[{"name":"Lighting"}]`},
+		{name: "Sub-collection record", method: http.MethodGet, url: "/store/categories/1", status: http.StatusOK, expected: `{"id":1,"name":"Lighting"}`},
+		{name: "Sub-collection record path", method: http.MethodGet, url: "/store/products/1/title", status: http.StatusOK, expected: `"Lamp"`},
+		{name: "Create in sub-collection", method: http.MethodPost, url: "/store/products", body: `{"title": "Desk"}`, status: http.StatusCreated, expected: `{"id":2,"title":"Desk"}`, location: "/store/products/2"},
+		{name: "Patch sub-collection record", method: http.MethodPatch, url: "/store/categories/1", body: `{"name": "Lights"}`, status: http.StatusOK, expected: `{"id":1,"name":"Lights"}`},
+		{name: "Delete from top-level array", method: http.MethodDelete, url: "/events/1", status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if location := w.Header().Get("Location"); location != tt.location {
+				t.Errorf("Expected Location %q, got %q", tt.location, location)
+			}
+			if tt.expected == "" {
+				return
+			}
+
+			var got bytes.Buffer
+			if err := json.Compact(&got, w.Body.Bytes()); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if got.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got.String())
+			}
+		})
+	}
+
+	// Both arrays were written back to the same file
+	if products := readTestRecords(t, app, "store.json", "products"); len(products) != 2 {
+		t.Errorf("Expected 2 products, got %v", products)
+	}
+	if categories := readTestRecords(t, app, "store.json", "categories"); categories[0]["name"] != "Lights" {
+		t.Errorf("Expected the patched category, got %v", categories)
+	}
+}
+
+// TestRemoveSubCollection tests that removing one array of a file leaves the
+// other arrays in place
+func TestRemoveSubCollection(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"store.json": `{"products": [{"id": 1, "title": "Lamp"}], "categories": [{"id": 1, "name": "Lighting"}]}`,
+	})
+	app.allowCollectionDelete = true
+
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/store/products?_remove=true", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for url, status := range map[string]int{"/store/products": http.StatusNotFound, "/store/categories/1": http.StatusOK} {
+		w := httptest.NewRecorder()
+		app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != status {
+			t.Errorf("Expected status code %d for %s, got %d: %s", status, url, w.Code, w.Body.String())
+		}
+	}
+	if categories := readTestRecords(t, app, "store.json", "categories"); len(categories) != 1 {
+		t.Errorf("Expected the categories to be kept, got %v", categories)
+	}
+}
+
+// TestGetFileRecordsBadFilter tests that malformed filters are rejected with a 400
+func TestGetFileRecordsBadFilter(t *testing.T) {
+	app := newTestApp(t, map[string]string{"products.json": testProducts})
+
+	for _, url := range []string{"/products?title_regex=(", "/products?title_exists=sometimes", "/products?_sort=,", "/products?_page=0", "/products?_start=2", "/products?_start=5&_limit=9223372036854775807", "/products?_page=9223372036854775807&_limit=2", "/products?_page=1000000&_limit=1000000", "/products?_cursor=bogus", "/products?_cursor=&_limit=9223372036854775807", "/products?_fields=", "/products/1?_exclude=a..b", "/products?q=a&_tokenize=perhaps"} {
+		w := httptest.NewRecorder()
+		app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, url, w.Code)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/RAshkettle/getter/internal/ids"
+	"github.com/RAshkettle/getter/internal/store"
+)
+
+// maxBodySize is the largest request body, in bytes, that write handlers accept.
+const maxBodySize = 10 << 20
+
+// idGenerator returns the id generator configured for the named collection,
+// falling back to the default strategy and then to inferring ids automatically.
+func (app *application) idGenerator(name string) ids.Generator {
+	if generator, ok := app.idGenerators[name]; ok {
+		return generator
+	}
+	if generator, ok := app.idGenerators[""]; ok {
+		return generator
+	}
+	return ids.Auto()
+}
+
+// writeJSON sends v as a JSON response with the given status code.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - status: The HTTP status code to send
+//   - v: The value to encode as the response body
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	content, err := store.EncodeJSON(v)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("error encoding response: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+// requestURL returns the absolute URL of a request, as seen by the client.
+func requestURL(r *http.Request) *url.URL {
+	u := *r.URL
+	u.Scheme = "http"
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	u.Host = r.Host
+	return &u
+}
+
+// readBody reads the request body, limited to maxBodySize bytes.
+// A body that can't be read is treated as empty.
+func readBody(r *http.Request) []byte {
+	content, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return nil
+	}
+	return content
+}
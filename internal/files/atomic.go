@@ -0,0 +1,100 @@
+package files
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempPrefix and tempSuffix surround the random part of the names of the
+// temporary files used by WriteFileAtomic.
+const (
+	tempPrefix = ".getter-"
+	tempSuffix = ".tmp"
+)
+
+// WriteFileAtomic writes data to the named file so that the file always holds
+// either its previous contents or the complete new contents, even if the process
+// crashes or the machine loses power partway through.
+//
+// The data is written to a temporary file in the same directory, flushed to
+// stable storage with fsync and then renamed over the target file. The directory
+// is synced afterwards so the rename itself is durable.
+//
+// Parameters:
+//   - path: The file to write
+//   - data: The new contents of the file
+//   - perm: The permissions used if the file does not exist yet
+//
+// Returns:
+//   - error: An error if any step fails; the target file is left untouched
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeAtomic(path, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeAtomic implements WriteFileAtomic with the contents produced by write.
+func writeAtomic(path string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	dir := filepath.Dir(path)
+
+	// Keep the permissions of an existing file
+	if info, statErr := os.Stat(path); statErr == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(dir, tempPrefix+filepath.Base(path)+"-*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes a directory entry change to stable storage. Not every
+// platform supports syncing directories, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// IsTemporary reports whether name is the name of a temporary file created by
+// WriteFileAtomic. Such files are only left behind if a writer crashes.
+//
+// Parameters:
+//   - name: The file name, without directory
+//
+// Returns:
+//   - bool: True if the name belongs to a temporary file
+func IsTemporary(name string) bool {
+	return strings.HasPrefix(name, tempPrefix) && strings.HasSuffix(name, tempSuffix)
+}
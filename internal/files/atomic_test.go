@@ -0,0 +1,221 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// helperEnv selects the behavior of the test binary when it is re-run as a
+// helper process by the crash and locking tests
+const helperEnv = "GETTER_FILES_HELPER"
+
+// TestHelperProcess is not a real test. It is run in a child process by the
+// tests below, which kill it partway through writing or while it holds a lock.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv(helperEnv)
+	if mode == "" {
+		t.Skip("Only runs as a helper process")
+	}
+	path := os.Getenv("GETTER_FILES_PATH")
+
+	switch mode {
+	case "partial-write":
+		// Write half of the new contents, report, then wait to be killed
+		writeAtomic(path, 0644, func(w io.Writer) error {
+			w.Write(bytes.Repeat([]byte("x"), 1<<16))
+			os.Stdout.WriteString("ready\n")
+			time.Sleep(time.Minute)
+			return nil
+		})
+	case "write-loop":
+		// Keep rewriting the file with complete documents until killed
+		os.Stdout.WriteString("ready\n")
+		for i := 0; ; i++ {
+			content := strings.Repeat(string(rune('a'+i%26)), 1<<18)
+			WriteFileAtomic(path, []byte(content), 0644)
+		}
+	case "hold-lock":
+		if _, err := LockPath(path); err != nil {
+			os.Exit(2)
+		}
+		os.Stdout.WriteString("ready\n")
+		time.Sleep(time.Minute)
+	}
+	os.Exit(0)
+}
+
+// startHelper runs the test binary as a helper process in the given mode and
+// waits until it reports that it is ready
+func startHelper(t *testing.T, mode, path string) *exec.Cmd {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), helperEnv+"="+mode, "GETTER_FILES_PATH="+path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("Failed to create stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start helper process: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "ready\n" {
+		t.Fatalf("Helper process did not become ready: %q, %v", line, err)
+	}
+	return cmd
+}
+
+// TestWriteFileAtomic tests that WriteFileAtomic replaces the file contents
+// and keeps the permissions of an existing file
+func TestWriteFileAtomic(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "products.json")
+
+	if err := WriteFileAtomic(path, []byte(`{"products": []}`), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic() error = %v", err)
+	}
+	if err := WriteFileAtomic(path, []byte(`{"products": [{"id": 1}]}`), 0644); err != nil {
+		t.Fatalf("WriteFileAtomic() error = %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != `{"products": [{"id": 1}]}` {
+		t.Errorf("Unexpected file contents %q", content)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600 to be kept, got %v", info.Mode().Perm())
+	}
+
+	// No temporary files should be left behind
+	names, err := ListFilesInDirectory(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to list directory: %v", err)
+	}
+	if len(names) != 1 {
+		t.Errorf("Expected only the target file, got %v", names)
+	}
+}
+
+// TestWriteFileAtomicKilledMidWrite tests that killing a writer partway through
+// a write leaves the original file intact
+func TestWriteFileAtomicKilledMidWrite(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "customers.json")
+	original := `{"customers": [{"id": "CUST-10058429"}]}`
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cmd := startHelper(t, "partial-write", path)
+	if err := cmd.Process.Kill(); err != nil {
+		t.Fatalf("Failed to kill helper process: %v", err)
+	}
+	cmd.Wait()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != original {
+		t.Errorf("Expected original contents to survive, got %d bytes", len(content))
+	}
+
+	// The interrupted write leaves only a recognizable temporary file
+	names, err := ListFilesInDirectory(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to list directory: %v", err)
+	}
+	for _, file := range names {
+		if file.Name != "customers.json" && !IsTemporary(file.Name) {
+			t.Errorf("Unexpected file %s left behind", file.Name)
+		}
+	}
+}
+
+// TestWriteFileAtomicKilledInLoop tests that a file being rewritten continuously
+// always holds one complete version when the writer is killed at an arbitrary point
+func TestWriteFileAtomicKilledInLoop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+
+	for i := 0; i < 3; i++ {
+		cmd := startHelper(t, "write-loop", path)
+		time.Sleep(time.Duration(20+15*i) * time.Millisecond)
+		if err := cmd.Process.Kill(); err != nil {
+			t.Fatalf("Failed to kill helper process: %v", err)
+		}
+		cmd.Wait()
+
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if len(content) != 1<<18 || strings.Trim(string(content), string(content[:1])) != "" {
+			t.Fatalf("File holds a partial write: %d bytes", len(content))
+		}
+	}
+}
+
+// TestLockPath tests that a lock held by another process blocks LockPath until
+// that process goes away
+func TestLockPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Advisory locks are not supported on this platform")
+	}
+
+	tempDir := t.TempDir()
+	cmd := startHelper(t, "hold-lock", tempDir)
+
+	acquired := make(chan *Lock)
+	go func() {
+		lock, err := LockPath(tempDir)
+		if err != nil {
+			t.Errorf("LockPath() error = %v", err)
+		}
+		acquired <- lock
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquired the lock while another process held it")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The lock is released when the holding process dies
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	select {
+	case lock := <-acquired:
+		if lock != nil {
+			if err := lock.Unlock(); err != nil {
+				t.Errorf("Unlock() error = %v", err)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lock was not acquired after the holding process exited")
+	}
+}
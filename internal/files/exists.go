@@ -1,5 +1,6 @@
 // Package files provides utility functions for file system operations
-// such as checking file/folder existence and path manipulation.
+// such as checking file/folder existence, path manipulation, atomic writes
+// and advisory locking.
 package files
 
 import (
@@ -4,16 +4,26 @@ import (
 	"os"
 )
 
-// ListFilesInDirectory returns a slice of filenames (without path) of all files in the specified directory.
-// It does not include subdirectories in the returned list, only files directly in the specified directory.
+// File describes a file in a directory.
+type File struct {
+	// Name is the file name, without path.
+	Name string `json:"name"`
+
+	// Format is the data format of the file, or "" if it is not a data file;
+	// see FileFormat.
+	Format string `json:"format,omitempty"`
+}
+
+// ListFilesInDirectory returns the files (without path) directly in the specified directory,
+// along with the data format of each. It does not include subdirectories in the returned list.
 //
 // Parameters:
 //   - dirPath: The path to the directory whose files should be listed
 //
 // Returns:
-//   - []string: A slice of filenames in the directory
+//   - []File: The files in the directory
 //   - error: An error if reading the directory fails or if the provided path is not a directory
-func ListFilesInDirectory(dirPath string) ([]string, error) {
+func ListFilesInDirectory(dirPath string) ([]File, error) {
 	// Check if the path exists and is a directory
 	info, err := os.Stat(dirPath)
 	if err != nil {
@@ -37,10 +47,10 @@ func ListFilesInDirectory(dirPath string) ([]string, error) {
 	}
 
 	// Filter out directories, keep only files
-	var files []string
+	var files []File
 	for _, entry := range entries {
 		if !entry.IsDir() {
-			files = append(files, entry.Name())
+			files = append(files, File{Name: entry.Name(), Format: FileFormat(entry.Name())})
 		}
 	}
 
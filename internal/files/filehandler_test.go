@@ -86,7 +86,8 @@ func TestListFilesInDirectory(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Call the function being tested
-			files, err := ListFilesInDirectory(tt.path)
+			listed, err := ListFilesInDirectory(tt.path)
+			files := fileNames(listed)
 
 			// Check error status
 			if tt.errorExpected && err == nil {
@@ -149,10 +150,11 @@ func TestListFilesInDirectoryWithSpecialCharacters(t *testing.T) {
 	}
 
 	// Get the files and check results
-	files, err := ListFilesInDirectory(tempDir)
+	listed, err := ListFilesInDirectory(tempDir)
 	if err != nil {
 		t.Fatalf("Error listing files: %v", err)
 	}
+	files := fileNames(listed)
 
 	// Sort both slices for comparison
 	sort.Strings(files)
@@ -187,4 +189,46 @@ func TestListFilesInDirectoryPermissions(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for non-existent path, but got nil")
 	}
-}
\ No newline at end of file
+}
+
+// TestListFilesInDirectoryFormats tests that data files are listed with their format
+func TestListFilesInDirectoryFormats(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"customers.json", "fixtures.yml", "orders.YAML", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("[]"), 0644); err != nil {
+			t.Fatalf("Failed to create test file %s: %v", name, err)
+		}
+	}
+
+	listed, err := ListFilesInDirectory(tempDir)
+	if err != nil {
+		t.Fatalf("Error listing files: %v", err)
+	}
+
+	expected := map[string]string{
+		"customers.json": FormatJSON,
+		"fixtures.yml":   FormatYAML,
+		"orders.YAML":    FormatYAML,
+		"notes.txt":      "",
+	}
+	if len(listed) != len(expected) {
+		t.Fatalf("Expected %d files, got %v", len(expected), listed)
+	}
+	for _, file := range listed {
+		if format, ok := expected[file.Name]; !ok || file.Format != format {
+			t.Errorf("Expected format %q for %s, got %q", format, file.Name, file.Format)
+		}
+	}
+}
+
+// fileNames returns the names of listed files
+func fileNames(files []File) []string {
+	if files == nil {
+		return nil
+	}
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.Name
+	}
+	return names
+}
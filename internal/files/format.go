@@ -0,0 +1,61 @@
+package files
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Data file formats, as reported by FileFormat.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatCSV  = "csv"
+	FormatTSV  = "tsv"
+
+	// FormatNDJSON is newline-delimited JSON, also known as JSON Lines: a
+	// JSON object per line.
+	FormatNDJSON = "ndjson"
+)
+
+// DataExtensions lists the extensions of data files. When files with several
+// of them share a base name, the first extension in the list is served.
+var DataExtensions = []string{".json", ".yaml", ".yml", ".csv", ".tsv", ".ndjson", ".jsonl"}
+
+// extensionFormats maps the extensions of data files to their formats.
+var extensionFormats = map[string]string{
+	".json":   FormatJSON,
+	".yaml":   FormatYAML,
+	".yml":    FormatYAML,
+	".csv":    FormatCSV,
+	".tsv":    FormatTSV,
+	".ndjson": FormatNDJSON,
+	".jsonl":  FormatNDJSON,
+}
+
+// FileFormat returns the data format of a file from its extension, ignoring
+// case.
+//
+// Parameters:
+//   - name: The file name or path
+//
+// Returns:
+//   - string: The format, such as FormatJSON, or "" if the file is not a data file
+func FileFormat(name string) string {
+	return extensionFormats[strings.ToLower(filepath.Ext(name))]
+}
+
+// TrimDataExtension removes the extension of a data file from a name, so
+// "customers.yaml" and "customers" both become "customers". Other names are
+// returned unchanged.
+//
+// Parameters:
+//   - name: The file or collection name
+//
+// Returns:
+//   - string: The name without a data file extension
+func TrimDataExtension(name string) string {
+	if FileFormat(name) == "" {
+		return name
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
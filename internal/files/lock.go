@@ -0,0 +1,44 @@
+package files
+
+import "os"
+
+// Lock is an advisory lock held on a file or directory. It coordinates
+// writers in different processes that use the same data directory; it does
+// not stop processes that ignore the lock from writing.
+type Lock struct {
+	f *os.File
+}
+
+// LockPath blocks until it holds an exclusive advisory lock on path, which may
+// be a file or a directory. The lock is released by Unlock, or by the operating
+// system if the process exits.
+//
+// Parameters:
+//   - path: The file or directory to lock
+//
+// Returns:
+//   - *Lock: The held lock
+//   - error: An error if the path can't be opened or locked
+func LockPath(path string) (*Lock, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// Unlock releases the lock.
+//
+// Returns:
+//   - error: An error if the lock can't be released
+func (l *Lock) Unlock() error {
+	err := unlockFile(l.f)
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
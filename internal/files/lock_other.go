@@ -0,0 +1,16 @@
+//go:build !unix
+
+package files
+
+import "os"
+
+// lockFile is a no-op on platforms without flock; writes are then only
+// serialized within a single process.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op on platforms without flock.
+func unlockFile(f *os.File) error {
+	return nil
+}
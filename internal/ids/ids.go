@@ -0,0 +1,370 @@
+// Package ids generates identifiers for new records. A Generator is chosen
+// from a strategy specification and produces ids that do not clash with the
+// ids already present in a collection.
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAttempts is the number of times a random id is regenerated when it
+// collides with an existing id before giving up.
+const maxAttempts = 100
+
+// ErrExhausted is returned when a generator can't produce an unused id.
+var ErrExhausted = errors.New("unable to generate an unused id")
+
+// Generator creates ids for new records.
+type Generator interface {
+	// Next returns a new id that is not among the existing ids.
+	Next(existing []interface{}) (interface{}, error)
+}
+
+// GeneratorFunc adapts an ordinary function to the Generator interface.
+type GeneratorFunc func(existing []interface{}) (interface{}, error)
+
+// Next calls f(existing).
+func (f GeneratorFunc) Next(existing []interface{}) (interface{}, error) {
+	return f(existing)
+}
+
+// Parse returns the Generator described by spec. The supported strategies are:
+//   - auto: infer a strategy from the existing ids (the default)
+//   - increment: the next integer after the largest existing integer id
+//   - uuid4: a random UUID (RFC 9562 version 4)
+//   - uuid7: a time-ordered UUID (RFC 9562 version 7)
+//   - ulid: a Universally Unique Lexicographically Sortable Identifier
+//   - prefix:<prefix>[:<digits>]: the prefix followed by random digits (8 by default)
+//   - template:<template>: a template such as "ORD-{date}-{seq:4}", see Template
+//
+// Parameters:
+//   - spec: The strategy specification
+//
+// Returns:
+//   - Generator: The generator for the strategy
+//   - error: An error if the strategy is unknown or its arguments are invalid
+func Parse(spec string) (Generator, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	switch name {
+	case "", "auto":
+		return Auto(), nil
+	case "increment":
+		return Increment(), nil
+	case "uuid4":
+		return random(UUIDv4), nil
+	case "uuid7":
+		return random(UUIDv7), nil
+	case "ulid":
+		return random(ULID), nil
+	case "prefix":
+		// The digit count is optional, so only a numeric last segment is taken as one
+		prefix, n := arg, 8
+		if i := strings.LastIndex(arg, ":"); i >= 0 {
+			digits, err := strconv.Atoi(arg[i+1:])
+			if err != nil || digits < 1 {
+				return nil, fmt.Errorf("invalid digit count %q in id strategy %q", arg[i+1:], spec)
+			}
+			prefix, n = arg[:i], digits
+		}
+		return Template(escapeTemplate(prefix) + "{digits:" + strconv.Itoa(n) + "}")
+	case "template":
+		return Template(arg)
+	}
+	return nil, fmt.Errorf("unknown id strategy %q", spec)
+}
+
+// Auto returns a Generator that infers the id format from the existing ids:
+// integer ids are incremented, UUIDs and ULIDs produce new values of the same
+// kind and ids made of a shared prefix and a fixed number of digits, such as
+// "CUST-10058429", produce ids with the same prefix and width. Densely numbered
+// ids like "ORD-0001" continue the sequence, sparse ones get random digits.
+// Anything else, including an empty collection of unknown type, gets a UUIDv4.
+func Auto() Generator {
+	return GeneratorFunc(func(existing []interface{}) (interface{}, error) {
+		return infer(existing).Next(existing)
+	})
+}
+
+// infer picks the generator matching the format of the existing ids.
+func infer(existing []interface{}) Generator {
+	if len(existing) == 0 {
+		return Increment()
+	}
+
+	allInts := true
+	for _, id := range existing {
+		if _, ok := toInt(id); !ok {
+			allInts = false
+			break
+		}
+	}
+	if allInts {
+		return Increment()
+	}
+
+	strs := make([]string, 0, len(existing))
+	for _, id := range existing {
+		s, ok := id.(string)
+		if !ok {
+			return random(UUIDv4)
+		}
+		strs = append(strs, s)
+	}
+
+	switch {
+	case all(strs, isUUID):
+		if all(strs, func(s string) bool { return s[14] == '7' }) {
+			return random(UUIDv7)
+		}
+		return random(UUIDv4)
+	case all(strs, isULID):
+		return random(ULID)
+	}
+
+	// Look for a shared prefix followed by a fixed number of digits
+	prefix, digits := splitDigits(strs[0])
+	if digits == "" {
+		return random(UUIDv4)
+	}
+	width := len(digits)
+	min, max := int64(-1), int64(-1)
+	for _, s := range strs {
+		p, d := splitDigits(s)
+		if p != prefix || len(d) != width {
+			return random(UUIDv4)
+		}
+		n, err := strconv.ParseInt(d, 10, 64)
+		if err != nil {
+			return random(UUIDv4)
+		}
+		if min < 0 || n < min {
+			min = n
+		}
+		if n > max {
+			max = n
+		}
+	}
+
+	// Dense numbering is treated as a sequence, sparse numbering as random
+	if max-min+1 <= int64(2*len(strs)) {
+		return mustTemplate(escapeTemplate(prefix) + "{seq:" + strconv.Itoa(width) + "}")
+	}
+	return mustTemplate(escapeTemplate(prefix) + "{digits:" + strconv.Itoa(width) + "}")
+}
+
+// Increment returns a Generator producing the next integer after the largest
+// existing integer id, starting at 1. Ids are returned as json.Number so they
+// are stored as JSON numbers.
+func Increment() Generator {
+	return GeneratorFunc(func(existing []interface{}) (interface{}, error) {
+		var max int64
+		for _, id := range existing {
+			if n, ok := toInt(id); ok && n > max {
+				max = n
+			}
+		}
+		return json.Number(strconv.FormatInt(max+1, 10)), nil
+	})
+}
+
+// Template returns a Generator that expands a template for each new id.
+// Literal text is copied as is and the following placeholders are replaced:
+//   - {digits:N}: N random decimal digits
+//   - {hex:N}: N random lowercase hexadecimal digits
+//   - {alnum:N}: N random uppercase letters and digits
+//   - {seq} or {seq:N}: one more than the largest sequence number among existing
+//     ids that match the template, zero-padded to N digits. Ids match when
+//     their {date} is today's and their random parts have the right form.
+//   - {date}: the current UTC date as YYYYMMDD
+//   - {uuid}: a random UUIDv4
+//   - {ulid}: a ULID
+//
+// A literal brace is written as {{ or }}.
+//
+// Parameters:
+//   - template: The template to expand
+//
+// Returns:
+//   - Generator: The template generator
+//   - error: An error if the template is malformed
+func Template(template string) (Generator, error) {
+	parts, err := parseTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	return GeneratorFunc(func(existing []interface{}) (interface{}, error) {
+		used := make(map[string]bool, len(existing))
+		for _, id := range existing {
+			used[fmt.Sprintf("%v", id)] = true
+		}
+
+		date := time.Now().UTC().Format(dateFormat)
+		seq := nextSequence(parts, existing, date)
+		for attempt := 0; attempt < maxAttempts; attempt++ {
+			id, err := expand(parts, seq, date)
+			if err != nil {
+				return nil, err
+			}
+			if !used[id] {
+				return id, nil
+			}
+			seq++
+		}
+		return nil, ErrExhausted
+	}), nil
+}
+
+// UUIDv4 returns a new random UUID (RFC 9562 version 4).
+func UUIDv4() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b), nil
+}
+
+// UUIDv7 returns a new time-ordered UUID (RFC 9562 version 7) whose first
+// 48 bits hold the current Unix time in milliseconds.
+func UUIDv7() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	ms := uint64(time.Now().UnixMilli())
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b), nil
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID returns a new ULID: a 48-bit millisecond timestamp followed by 80 random
+// bits, encoded as 26 characters of Crockford base32.
+func ULID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	ms := uint64(time.Now().UnixMilli())
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+
+	// Encode the 128 bits as 26 base32 characters, most significant first
+	n := new(big.Int).SetBytes(b[:])
+	out := make([]byte, 26)
+	mask := big.NewInt(31)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, 5)
+	}
+	return string(out), nil
+}
+
+// random returns a Generator that calls newID until it produces an unused id.
+func random(newID func() (string, error)) Generator {
+	return GeneratorFunc(func(existing []interface{}) (interface{}, error) {
+		used := make(map[string]bool, len(existing))
+		for _, id := range existing {
+			used[fmt.Sprintf("%v", id)] = true
+		}
+		for attempt := 0; attempt < maxAttempts; attempt++ {
+			id, err := newID()
+			if err != nil {
+				return nil, err
+			}
+			if !used[id] {
+				return id, nil
+			}
+		}
+		return nil, ErrExhausted
+	})
+}
+
+// formatUUID formats 16 bytes in the canonical 8-4-4-4-12 UUID layout.
+func formatUUID(b [16]byte) string {
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// isUUID reports whether s is in the canonical UUID layout.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isULID reports whether s is a 26 character Crockford base32 string.
+func isULID(s string) bool {
+	if len(s) != 26 {
+		return false
+	}
+	for _, c := range strings.ToUpper(s) {
+		if !strings.ContainsRune(crockford, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// all reports whether every string satisfies f.
+func all(strs []string, f func(string) bool) bool {
+	for _, s := range strs {
+		if !f(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitDigits splits s into a prefix and its trailing run of decimal digits.
+func splitDigits(s string) (string, string) {
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+	return s[:i], s[i:]
+}
+
+// toInt converts a decoded JSON integer to an int64.
+func toInt(id interface{}) (int64, bool) {
+	switch v := id.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	case float64:
+		return int64(v), v == float64(int64(v))
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,277 @@
+package ids
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParse tests that strategy specifications produce ids of the right shape
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		existing []interface{}
+		pattern  string
+		wantErr  bool
+	}{
+		{
+			name:     "Increment",
+			spec:     "increment",
+			existing: []interface{}{json.Number("1"), json.Number("7"), json.Number("3")},
+			pattern:  `^8$`,
+		},
+		{
+			name:    "Increment empty collection",
+			spec:    "increment",
+			pattern: `^1$`,
+		},
+		{
+			name:    "UUIDv4",
+			spec:    "uuid4",
+			pattern: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+		},
+		{
+			name:    "UUIDv7",
+			spec:    "uuid7",
+			pattern: `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+		},
+		{
+			name:    "ULID",
+			spec:    "ulid",
+			pattern: `^[0-9A-HJKMNP-TV-Z]{26}$`,
+		},
+		{
+			name:    "Prefix with default digits",
+			spec:    "prefix:CUST-",
+			pattern: `^CUST-\d{8}$`,
+		},
+		{
+			name:    "Prefix with digits",
+			spec:    "prefix:SKU-:4",
+			pattern: `^SKU-\d{4}$`,
+		},
+		{
+			name:     "Template with sequence",
+			spec:     "template:ORD-{seq:4}",
+			existing: []interface{}{"ORD-0001", "ORD-0009"},
+			pattern:  `^ORD-0010$`,
+		},
+		{
+			name:    "Template with literal braces",
+			spec:    "template:{{{hex:6}}}",
+			pattern: `^\{[0-9a-f]{6}\}$`,
+		},
+		{
+			name:    "Template with date and alnum",
+			spec:    "template:{date}-{alnum:5}",
+			pattern: `^\d{8}-[0-9A-Z]{5}$`,
+		},
+		{
+			name:    "Unknown strategy",
+			spec:    "sequential",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown placeholder",
+			spec:    "template:{random:4}",
+			wantErr: true,
+		},
+		{
+			name:    "Missing width",
+			spec:    "template:{digits}",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid digit count",
+			spec:    "prefix:CUST-:none",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			id, err := generator.Next(tt.existing)
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+
+			if !regexp.MustCompile(tt.pattern).MatchString(toString(id)) {
+				t.Errorf("Next() = %v, want match for %s", id, tt.pattern)
+			}
+		})
+	}
+}
+
+// TestAuto tests that the automatic strategy follows the format of existing ids
+func TestAuto(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []interface{}
+		pattern  string
+		number   bool
+	}{
+		{
+			name:     "Integer ids",
+			existing: []interface{}{json.Number("1"), json.Number("2"), json.Number("10")},
+			pattern:  `^11$`,
+			number:   true,
+		},
+		{
+			name:     "Float-decoded integer ids",
+			existing: []interface{}{float64(4), float64(5)},
+			pattern:  `^6$`,
+			number:   true,
+		},
+		{
+			name:     "Sparse prefixed ids",
+			existing: []interface{}{"CUST-10058429", "CUST-20937164", "CUST-30128745"},
+			pattern:  `^CUST-\d{8}$`,
+		},
+		{
+			name:     "Dense prefixed ids",
+			existing: []interface{}{"ORD-0001", "ORD-0002", "ORD-0003"},
+			pattern:  `^ORD-0004$`,
+		},
+		{
+			name:     "UUIDv4 ids",
+			existing: []interface{}{"0b6f8e4c-3f4a-4c1e-9a51-7d0f5e2c8b11"},
+			pattern:  `^[0-9a-f]{8}-[0-9a-f]{4}-4`,
+		},
+		{
+			name:     "UUIDv7 ids",
+			existing: []interface{}{"01890a5d-ac96-774b-bcce-b302099a8057"},
+			pattern:  `^[0-9a-f]{8}-[0-9a-f]{4}-7`,
+		},
+		{
+			name:     "ULID ids",
+			existing: []interface{}{"01ARZ3NDEKTSV4RRFFQ69G5FAV"},
+			pattern:  `^[0-9A-HJKMNP-TV-Z]{26}$`,
+		},
+		{
+			name:     "Mixed ids",
+			existing: []interface{}{"alpha", json.Number("2")},
+			pattern:  `^[0-9a-f]{8}-[0-9a-f]{4}-4`,
+		},
+		{
+			name:    "Empty collection",
+			pattern: `^1$`,
+			number:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := Auto().Next(tt.existing)
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+
+			if _, isNumber := id.(json.Number); isNumber != tt.number {
+				t.Errorf("Expected numeric id: %v, got %T", tt.number, id)
+			}
+
+			if !regexp.MustCompile(tt.pattern).MatchString(toString(id)) {
+				t.Errorf("Next() = %v, want match for %s", id, tt.pattern)
+			}
+		})
+	}
+}
+
+// TestTemplateAvoidsExistingIDs tests that generated ids never reuse an existing id
+func TestTemplateAvoidsExistingIDs(t *testing.T) {
+	generator, err := Parse("prefix:X:1")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	existing := []interface{}{"X0", "X1", "X2", "X3", "X4", "X5", "X6", "X7", "X8"}
+	id, err := generator.Next(existing)
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if id != "X9" {
+		t.Errorf("Expected the only unused id X9, got %v", id)
+	}
+
+	_, err = generator.Next(append(existing, "X9"))
+	if err != ErrExhausted {
+		t.Errorf("Expected ErrExhausted when every id is used, got %v", err)
+	}
+}
+
+// TestTemplateSequence tests that {seq} continues from the existing ids that
+// match the whole template, including its other placeholders
+func TestTemplateSequence(t *testing.T) {
+	today := time.Now().UTC().Format("20060102")
+
+	// More existing ids for the day than a generator tries before giving up
+	var orders []interface{}
+	for i := 1; i <= 150; i++ {
+		orders = append(orders, fmt.Sprintf("ORD-%s-%04d", today, i))
+	}
+
+	tests := []struct {
+		name     string
+		spec     string
+		existing []interface{}
+		expected string
+	}{
+		{name: "Date", spec: "template:ORD-{date}-{seq:4}", existing: orders, expected: "ORD-" + today + "-0151"},
+		{name: "Other days don't count", spec: "template:ORD-{date}-{seq:4}", existing: []interface{}{"ORD-19990101-0900", "ORD-" + today + "-0007"}, expected: "ORD-" + today + "-0008"},
+		{name: "Random part", spec: "template:{hex:2}-{seq}", existing: []interface{}{"0a-41", "ff-9", "xyz-99"}, expected: "-42"},
+		{name: "Literal text with regexp characters", spec: "template:A.{seq}+", existing: []interface{}{"A.5+", "AX6+"}, expected: "A.6+"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			id, err := generator.Next(tt.existing)
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			if !strings.HasSuffix(id.(string), tt.expected) {
+				t.Errorf("Expected an id ending in %s, got %v", tt.expected, id)
+			}
+		})
+	}
+}
+
+// TestULIDOrdering tests that ULIDs generated later sort after earlier ones
+func TestULIDOrdering(t *testing.T) {
+	first, err := ULID()
+	if err != nil {
+		t.Fatalf("ULID() error = %v", err)
+	}
+	second, err := ULID()
+	if err != nil {
+		t.Fatalf("ULID() error = %v", err)
+	}
+
+	// Only the timestamp portion is ordered; it must never go backwards
+	if strings.Compare(first[:10], second[:10]) > 0 {
+		t.Errorf("Expected %s to sort before %s", first, second)
+	}
+}
+
+// toString formats an id for matching
+func toString(id interface{}) string {
+	if s, ok := id.(string); ok {
+		return s
+	}
+	return string(id.(json.Number))
+}
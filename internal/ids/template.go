@@ -0,0 +1,232 @@
+package ids
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// part is a piece of a parsed template: either literal text or a placeholder
+// with an optional width.
+type part struct {
+	literal string
+	kind    string
+	width   int
+}
+
+// parseTemplate splits a template into literal text and placeholders.
+func parseTemplate(template string) ([]part, error) {
+	var parts []part
+	var literal strings.Builder
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case c == '{' && strings.HasPrefix(template[i:], "{{"):
+			literal.WriteByte('{')
+			i++
+		case c == '}' && strings.HasPrefix(template[i:], "}}"):
+			literal.WriteByte('}')
+			i++
+		case c == '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated placeholder in id template %q", template)
+			}
+			p, err := parsePlaceholder(template[i+1 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("%w in id template %q", err, template)
+			}
+			if literal.Len() > 0 {
+				parts = append(parts, part{literal: literal.String()})
+				literal.Reset()
+			}
+			parts = append(parts, p)
+			i += end
+		case c == '}':
+			return nil, fmt.Errorf("unexpected '}' in id template %q", template)
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	if literal.Len() > 0 {
+		parts = append(parts, part{literal: literal.String()})
+	}
+
+	return parts, nil
+}
+
+// parsePlaceholder parses the contents of a {kind:width} placeholder.
+func parsePlaceholder(s string) (part, error) {
+	kind, arg, hasWidth := strings.Cut(s, ":")
+	p := part{kind: kind}
+
+	switch kind {
+	case "digits", "hex", "alnum":
+		if !hasWidth {
+			return p, fmt.Errorf("placeholder {%s} needs a width", kind)
+		}
+	case "seq":
+	case "date", "uuid", "ulid":
+		if hasWidth {
+			return p, fmt.Errorf("placeholder {%s} does not take a width", kind)
+		}
+	default:
+		return p, fmt.Errorf("unknown placeholder {%s}", s)
+	}
+
+	if hasWidth {
+		width, err := strconv.Atoi(arg)
+		if err != nil || width < 1 {
+			return p, fmt.Errorf("invalid width in placeholder {%s}", s)
+		}
+		p.width = width
+	}
+	return p, nil
+}
+
+// mustTemplate is like Template but panics if the template is malformed.
+// It is only used with templates built by this package.
+func mustTemplate(template string) Generator {
+	g, err := Template(template)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// escapeTemplate escapes braces so text can be used literally in a template.
+func escapeTemplate(s string) string {
+	return strings.NewReplacer("{", "{{", "}", "}}").Replace(s)
+}
+
+// dateFormat is the layout of the {date} placeholder.
+const dateFormat = "20060102"
+
+// expand produces an id from the template parts using seq for {seq} and date
+// for {date}.
+func expand(parts []part, seq int64, date string) (string, error) {
+	var b strings.Builder
+	for _, p := range parts {
+		switch p.kind {
+		case "":
+			b.WriteString(p.literal)
+		case "digits":
+			s, err := randomString("0123456789", p.width)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s)
+		case "hex":
+			s, err := randomString("0123456789abcdef", p.width)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s)
+		case "alnum":
+			s, err := randomString("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ", p.width)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s)
+		case "seq":
+			fmt.Fprintf(&b, "%0*d", p.width, seq)
+		case "date":
+			b.WriteString(date)
+		case "uuid":
+			s, err := UUIDv4()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s)
+		case "ulid":
+			s, err := ULID()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s)
+		}
+	}
+	return b.String(), nil
+}
+
+// nextSequence returns one more than the largest {seq} value among the
+// existing ids that match the template. {date} must match the given date, so
+// the sequence restarts each day, and random placeholders match any value of
+// their form. Without a {seq} placeholder the sequence is 1.
+func nextSequence(parts []part, existing []interface{}, date string) int64 {
+	pattern, ok := sequencePattern(parts, date)
+	if !ok {
+		return 1
+	}
+
+	var max int64
+	for _, id := range existing {
+		match := pattern.FindStringSubmatch(fmt.Sprintf("%v", id))
+		if match == nil {
+			continue
+		}
+		n, err := strconv.ParseInt(match[1], 10, 64)
+		if err == nil && n > max {
+			max = n
+		}
+	}
+	return max + 1
+}
+
+// sequencePattern returns a regular expression matching the ids the template
+// produces on the given date, capturing the value of its first {seq}
+// placeholder, or false if the template has none.
+func sequencePattern(parts []part, date string) (*regexp.Regexp, bool) {
+	var b strings.Builder
+	b.WriteString("^")
+	hasSeq := false
+	for _, p := range parts {
+		switch p.kind {
+		case "":
+			b.WriteString(regexp.QuoteMeta(p.literal))
+		case "digits":
+			fmt.Fprintf(&b, "[0-9]{%d}", p.width)
+		case "hex":
+			fmt.Fprintf(&b, "[0-9a-f]{%d}", p.width)
+		case "alnum":
+			fmt.Fprintf(&b, "[0-9A-Z]{%d}", p.width)
+		case "seq":
+			if hasSeq {
+				b.WriteString("[0-9]+")
+			} else {
+				b.WriteString("([0-9]+)")
+				hasSeq = true
+			}
+		case "date":
+			b.WriteString(regexp.QuoteMeta(date))
+		case "uuid":
+			b.WriteString("[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}")
+		case "ulid":
+			b.WriteString("[0-9A-HJKMNP-TV-Z]{26}")
+		}
+	}
+	b.WriteString("$")
+
+	if !hasSeq {
+		return nil, false
+	}
+	return regexp.MustCompile(b.String()), true
+}
+
+// randomString returns n characters chosen uniformly at random from alphabet.
+func randomString(alphabet string, n int) (string, error) {
+	out := make([]byte, n)
+	limit := big.NewInt(int64(len(alphabet)))
+	for i := range out {
+		idx, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		out[i] = alphabet[idx.Int64()]
+	}
+	return string(out), nil
+}
@@ -0,0 +1,207 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CursorIDPath is the default field that breaks ties between records with
+// equal sort values, so that every record has a unique position for a cursor.
+// Collections identified by other fields pass them to Slice instead.
+const CursorIDPath = "id"
+
+// Cursor selects the records after a position in the sort order. Unlike an
+// offset, the position is the sort values and id of the last record a client
+// has seen, so pages stay stable while records are added or removed.
+type Cursor struct {
+	// Limit is the maximum number of records in the slice.
+	Limit int
+
+	// after holds the sort values of the last record of the previous page,
+	// followed by its id fields; it is nil for the first page.
+	after []sortValue
+}
+
+// cursorToken is the decoded form of the opaque _cursor parameter.
+type cursorToken struct {
+	Sort   string        `json:"s"`
+	Values []cursorValue `json:"v"`
+}
+
+// cursorValue is the serialized form of a sortValue.
+type cursorValue struct {
+	Rank int     `json:"r"`
+	Num  float64 `json:"n,omitempty"`
+	Time string  `json:"t,omitempty"`
+	Str  string  `json:"s,omitempty"`
+}
+
+// ParseCursor reads cursor pagination from the query string. An empty _cursor
+// requests the first page and the next_cursor of each page requests the one
+// after it. _limit sets the page size, 10 by default and at most MaxParam.
+//
+// Parameters:
+//   - values: The parsed query string
+//   - keys: The sort order of the request, which the cursor must have been created with
+//
+// Returns:
+//   - *Cursor: The requested slice, or nil if no _cursor was given
+//   - error: An error if the cursor is malformed or the parameters conflict
+func ParseCursor(values url.Values, keys []SortKey) (*Cursor, error) {
+	if _, ok := values["_cursor"]; !ok {
+		return nil, nil
+	}
+	for _, name := range []string{"_page", "_start", "_end"} {
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("_cursor can't be combined with %s", name)
+		}
+	}
+
+	limit, hasLimit, err := intParam(values, "_limit", 1)
+	if err != nil {
+		return nil, err
+	}
+	if !hasLimit {
+		limit = DefaultLimit
+	}
+
+	cursor := &Cursor{Limit: limit}
+	s := values.Get("_cursor")
+	if s == "" {
+		return cursor, nil
+	}
+
+	var token cursorToken
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(raw, &token)
+	}
+	if err != nil || len(token.Values) <= len(keys) {
+		return nil, fmt.Errorf("invalid _cursor")
+	}
+	if token.Sort != sortString(keys) {
+		return nil, fmt.Errorf("_cursor was created with a different _sort")
+	}
+
+	for _, v := range token.Values {
+		value := sortValue{rank: v.Rank, num: v.Num, str: v.Str}
+		if v.Rank == rankTime {
+			if value.time, err = time.Parse(time.RFC3339Nano, v.Time); err != nil {
+				return nil, fmt.Errorf("invalid _cursor")
+			}
+		}
+		cursor.after = append(cursor.after, value)
+	}
+	return cursor, nil
+}
+
+// Slice sorts the records and returns the page after the cursor position.
+// Records are ordered by the sort keys and then by their id fields. A cursor
+// created for different id fields selects no records.
+//
+// Parameters:
+//   - records: All matching records
+//   - keys: The sort order of the request
+//   - idPaths: The fields identifying a record, or nil for CursorIDPath
+//
+// Returns:
+//   - []map[string]interface{}: The records on the page, possibly none
+//   - string: The cursor for the next page, or "" if this is the last page
+func (c *Cursor) Slice(records []map[string]interface{}, keys []SortKey, idPaths []string) ([]map[string]interface{}, string) {
+	if idPaths == nil {
+		idPaths = []string{CursorIDPath}
+	}
+	all := keys[:len(keys):len(keys)]
+	for _, path := range idPaths {
+		all = append(all, SortKey{Path: path})
+	}
+	if c.after != nil && len(c.after) != len(all) {
+		return nil, ""
+	}
+	sorted := SortRecords(records, all)
+
+	start := 0
+	if c.after != nil {
+		start = sort.Search(len(sorted), func(i int) bool {
+			return compareKeys(sortValues(sorted[i], all), c.after, all) > 0
+		})
+	}
+	// Compared as a count rather than added to start, so that no limit
+	// can overflow
+	end := len(sorted)
+	if c.Limit < end-start {
+		end = start + c.Limit
+	}
+
+	next := ""
+	if end < len(sorted) {
+		next = encodeCursor(sortValues(sorted[end-1], all), keys)
+	}
+	return sorted[start:end], next
+}
+
+// Link builds an RFC 8288 Link header value pointing at the next page.
+//
+// Parameters:
+//   - base: The absolute URL of the current request
+//   - next: The cursor of the next page
+//
+// Returns:
+//   - string: The Link header value
+func (c *Cursor) Link(base *url.URL, next string) string {
+	u := *base
+	values := u.Query()
+	values.Set("_cursor", next)
+	values.Set("_limit", fmt.Sprint(c.Limit))
+	u.RawQuery = values.Encode()
+	return fmt.Sprintf(`<%s>; rel="next"`, u.String())
+}
+
+// sortValues extracts the values of a record for each sort key.
+func sortValues(record map[string]interface{}, keys []SortKey) []sortValue {
+	values := make([]sortValue, len(keys))
+	for i, key := range keys {
+		values[i] = newSortValue(record, key.Path)
+	}
+	return values
+}
+
+// compareKeys compares two records' sort values key by key.
+func compareKeys(a, b []sortValue, keys []SortKey) int {
+	for i, key := range keys {
+		if c := compareSortValues(a[i], b[i], key.Desc); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// sortString returns the sort keys in their query string form.
+func sortString(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// encodeCursor serializes a position in the sort order as an opaque token.
+func encodeCursor(values []sortValue, keys []SortKey) string {
+	token := cursorToken{Sort: sortString(keys)}
+	for _, v := range values {
+		cv := cursorValue{Rank: v.rank, Num: v.num, Str: v.str}
+		if v.rank == rankTime {
+			cv.Time = v.time.Format(time.RFC3339Nano)
+		}
+		token.Values = append(token.Values, cv)
+	}
+
+	// Marshalling plain numbers and strings can't fail
+	raw, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,115 @@
+package query
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// pageThrough follows cursors from the first page to the last, returning the
+// ids on each page
+func pageThrough(t *testing.T, records []map[string]interface{}, query string) []string {
+	t.Helper()
+
+	var pages []string
+	next := ""
+	for {
+		values, _ := url.ParseQuery(query)
+		values.Set("_cursor", next)
+		q, err := Parse(values)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+
+		result := q.Apply(records, nil)
+		pages = append(pages, ids(result.Records))
+		if next = result.NextCursor; next == "" {
+			return pages
+		}
+		if len(pages) > len(records) {
+			t.Fatalf("Cursor pagination did not terminate: %v", pages)
+		}
+	}
+}
+
+// TestCursorPagination tests walking a collection with cursors
+func TestCursorPagination(t *testing.T) {
+	records := decodeRecords(t, testEvents)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "Id order", query: "_limit=4", expected: "1,2,3,4|5,6"},
+		{name: "Default limit", query: "", expected: "1,2,3,4,5,6"},
+		{name: "Largest limit", query: "_limit=1000000000", expected: "1,2,3,4,5,6"},
+		{name: "Dates with missing values", query: "_sort=date&_limit=2", expected: "3,5|2,1|4,6"},
+		{name: "Ties broken by id", query: "_sort=-group&_limit=2", expected: "1,3|6,2|4,5"},
+		{name: "Filtered", query: "group=a&_sort=-title&_limit=2", expected: "4,5|2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(pageThrough(t, records, tt.query), "|"); got != tt.expected {
+				t.Errorf("Expected pages %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestCursorStableAcrossChanges tests that a cursor keeps its position when
+// records before it are added or removed
+func TestCursorStableAcrossChanges(t *testing.T) {
+	records := decodeRecords(t, testEvents)
+
+	q, err := Parse(url.Values{"_sort": {"date"}, "_cursor": {""}, "_limit": {"2"}})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	first := q.Apply(records, nil)
+	if got := ids(first.Records); got != "3,5" {
+		t.Fatalf("Expected first page %q, got %q", "3,5", got)
+	}
+
+	// Remove a record from the first page and add one that sorts before the cursor
+	changed := decodeRecords(t, `[{"id": 7, "date": "2000-01-01"}]`)
+	for _, record := range records {
+		if toString(record["id"]) != "3" {
+			changed = append(changed, record)
+		}
+	}
+
+	q, err = Parse(url.Values{"_sort": {"date"}, "_cursor": {first.NextCursor}, "_limit": {"2"}})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := ids(q.Apply(changed, nil).Records); got != "2,1" {
+		t.Errorf("Expected second page %q, got %q", "2,1", got)
+	}
+}
+
+// TestParseCursorErrors tests that malformed cursors are rejected
+func TestParseCursorErrors(t *testing.T) {
+	records := decodeRecords(t, testEvents)
+	q, _ := Parse(url.Values{"_sort": {"price"}, "_cursor": {""}, "_limit": {"1"}})
+	next := q.Apply(records, nil).NextCursor
+
+	for _, query := range []string{
+		"_cursor=not-a-cursor",
+		"_cursor=&_page=2",
+		"_cursor=&_start=0&_end=2",
+		"_cursor=&_limit=0",
+		"_cursor=&_limit=9223372036854775807",
+		"_sort=title&_cursor=" + next,
+	} {
+		values, _ := url.ParseQuery(query)
+		if _, err := Parse(values); err == nil {
+			t.Errorf("Expected an error for %q", query)
+		}
+	}
+
+	if _, err := Parse(url.Values{"_sort": {"price"}, "_cursor": {next}}); err != nil {
+		t.Errorf("Expected the cursor to be accepted, got %v", err)
+	}
+}
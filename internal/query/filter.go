@@ -0,0 +1,303 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operators supported as suffixes of filter parameters, e.g. price_gte=100.
+// A parameter without a known suffix is an equality filter.
+const (
+	OpEq     = "eq"
+	OpNe     = "ne"
+	OpGt     = "gt"
+	OpGte    = "gte"
+	OpLt     = "lt"
+	OpLte    = "lte"
+	OpLike   = "like"
+	OpRegex  = "regex"
+	OpIn     = "in"
+	OpExists = "exists"
+)
+
+// operators lists the suffixes recognized by ParseFilters.
+var operators = map[string]bool{
+	OpEq: true, OpNe: true, OpGt: true, OpGte: true, OpLt: true, OpLte: true,
+	OpLike: true, OpRegex: true, OpIn: true, OpExists: true,
+}
+
+// Filter selects records whose field at Path satisfies the operator Op for
+// the given Values.
+type Filter struct {
+	// Path is the dotted path of the field, e.g. "address.state".
+	Path string
+
+	// Op is the comparison to apply, one of the Op constants.
+	Op string
+
+	// Values are the operands from the query string. For most operators a
+	// record matches if any of them matches; for OpNe it must differ from all.
+	Values []string
+
+	patterns []*regexp.Regexp
+	exists   bool
+}
+
+// IsReserved reports whether a query parameter controls the request itself,
+// such as sorting or paging, rather than filtering on a field. Reserved
+// parameters start with an underscore, apart from q, the full-text search.
+func IsReserved(param string) bool {
+	return strings.HasPrefix(param, "_") || param == "q"
+}
+
+// ParseFilters builds the filters described by a query string. Every parameter
+// that is not reserved filters on the field it names, using a dotted path for
+// nested objects. Repeating a parameter accepts any of its values, so
+// ?lastName=Chen&lastName=Garcia matches either name. Different parameters
+// must all match.
+//
+// A parameter may end in an operator suffix:
+//   - _ne: not equal to any of the values (records without the field match)
+//   - _gt, _gte, _lt, _lte: numeric comparison for numbers, lexical otherwise,
+//     which orders ISO-8601 dates chronologically
+//   - _like: case-insensitive substring match
+//   - _regex: regular expression match (RE2 syntax)
+//   - _in: equal to one of a comma-separated list of values
+//   - _exists: true if the field must be present, false if it must be absent
+//
+// Parameters:
+//   - values: The parsed query string
+//
+// Returns:
+//   - []Filter: The filters, ordered by parameter
+//   - error: An error describing the first invalid filter
+func ParseFilters(values url.Values) ([]Filter, error) {
+	params := make([]string, 0, len(values))
+	for param := range values {
+		if !IsReserved(param) {
+			params = append(params, param)
+		}
+	}
+	sort.Strings(params)
+
+	filters := make([]Filter, 0, len(params))
+	for _, param := range params {
+		f, err := parseFilter(param, values[param])
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// parseFilter builds the filter for a single query parameter.
+func parseFilter(param string, vals []string) (Filter, error) {
+	f := Filter{Path: param, Op: OpEq, Values: vals}
+	if i := strings.LastIndex(param, "_"); i >= 0 && operators[param[i+1:]] {
+		f.Path, f.Op = param[:i], param[i+1:]
+	}
+	if !ValidPath(f.Path) {
+		return f, fmt.Errorf("invalid field path in filter %q", param)
+	}
+
+	switch f.Op {
+	case OpGt, OpGte, OpLt, OpLte:
+		for _, v := range vals {
+			if v == "" {
+				return f, fmt.Errorf("filter %q needs a value to compare with", param)
+			}
+		}
+	case OpRegex:
+		for _, v := range vals {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return f, fmt.Errorf("invalid regular expression in filter %q: %v", param, err)
+			}
+			f.patterns = append(f.patterns, re)
+		}
+	case OpIn:
+		var list []string
+		for _, v := range vals {
+			list = append(list, strings.Split(v, ",")...)
+		}
+		f.Values = list
+	case OpExists:
+		if len(vals) != 1 {
+			return f, fmt.Errorf("filter %q takes a single value", param)
+		}
+		exists, err := strconv.ParseBool(vals[0])
+		if err != nil {
+			return f, fmt.Errorf("filter %q must be true or false", param)
+		}
+		f.exists = exists
+	}
+	return f, nil
+}
+
+// Match reports whether a record satisfies the filter.
+//
+// Parameters:
+//   - record: The record to test
+//
+// Returns:
+//   - bool: True if the record's field satisfies the filter
+func (f Filter) Match(record map[string]interface{}) bool {
+	value, ok := Lookup(record, f.Path)
+
+	switch f.Op {
+	case OpExists:
+		return ok == f.exists
+	case OpNe:
+		if !ok {
+			return true
+		}
+		for _, s := range f.Values {
+			if equals(value, s) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !ok {
+		return false
+	}
+
+	switch f.Op {
+	case OpRegex:
+		for _, re := range f.patterns {
+			if matchScalars(value, func(s string) bool { return re.MatchString(s) }) {
+				return true
+			}
+		}
+		return false
+	case OpLike:
+		for _, v := range f.Values {
+			needle := strings.ToLower(v)
+			if matchScalars(value, func(s string) bool { return strings.Contains(strings.ToLower(s), needle) }) {
+				return true
+			}
+		}
+		return false
+	case OpGt, OpGte, OpLt, OpLte:
+		for _, v := range f.Values {
+			if compareTo(value, v, f.Op) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// OpEq and OpIn
+	for _, s := range f.Values {
+		if equals(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchScalars applies a string predicate to a scalar value, or to each
+// element of an array. Numbers and booleans are matched in their JSON form.
+func matchScalars(value interface{}, match func(string) bool) bool {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, element := range v {
+			if matchScalars(element, match) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}, nil:
+		return false
+	}
+
+	s, ok := scalarString(value)
+	return ok && match(s)
+}
+
+// compareTo reports whether value relates to the operand s as op requires.
+// Numbers are compared numerically when the operand is a number; strings are
+// compared lexically. Arrays match if any element does.
+func compareTo(value interface{}, s string, op string) bool {
+	if elements, ok := value.([]interface{}); ok {
+		for _, element := range elements {
+			if compareTo(element, s, op) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var cmp int
+	if f, ok := toFloat(value); ok {
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return false
+		}
+		cmp = compareFloats(f, n)
+	} else if str, ok := value.(string); ok {
+		cmp = strings.Compare(str, s)
+	} else {
+		return false
+	}
+
+	switch op {
+	case OpGt:
+		return cmp > 0
+	case OpGte:
+		return cmp >= 0
+	case OpLt:
+		return cmp < 0
+	default:
+		return cmp <= 0
+	}
+}
+
+// compareFloats returns -1, 0 or 1 as a is less than, equal to or greater than b.
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// FilterRecords returns the records that satisfy every filter, keeping their order.
+//
+// Parameters:
+//   - records: The records to filter
+//   - filters: The filters to apply
+//
+// Returns:
+//   - []map[string]interface{}: The matching records
+func FilterRecords(records []map[string]interface{}, filters []Filter) []map[string]interface{} {
+	if len(filters) == 0 {
+		return records
+	}
+
+	matched := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		if matchAll(record, filters) {
+			matched = append(matched, record)
+		}
+	}
+	return matched
+}
+
+// matchAll reports whether a record satisfies every filter.
+func matchAll(record map[string]interface{}, filters []Filter) bool {
+	for _, f := range filters {
+		if !f.Match(record) {
+			return false
+		}
+	}
+	return true
+}
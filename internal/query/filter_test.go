@@ -0,0 +1,201 @@
+package query
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// testCustomers is decoded into the records used by the query tests
+const testCustomers = `[
+  {"id": "CUST-10058429", "lastName": "Johnson", "active": true, "address": {"city": "Portland", "state": "OR"}, "tags": ["vip", "west"]},
+  {"id": "CUST-20937164", "lastName": "Chen", "active": false, "address": {"city": "Austin", "state": "TX"}, "tags": ["west"]},
+  {"id": "CUST-30128745", "lastName": "Garcia", "active": true, "address": {"city": "Chicago", "state": "IL"}, "manager": null},
+  {"id": "CUST-40593217", "lastName": "Chen", "active": true, "address": {"city": "Salem", "state": "OR"}},
+  {"id": 1, "lastName": "Numeric", "score": 1.5}
+]`
+
+// decodeRecords decodes a JSON array of records the way the store does
+func decodeRecords(t testing.TB, s string) []map[string]interface{} {
+	t.Helper()
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	var records []map[string]interface{}
+	if err := decoder.Decode(&records); err != nil {
+		t.Fatalf("Failed to decode records: %v", err)
+	}
+	return records
+}
+
+// ids returns the ids of records, formatted as strings
+func ids(records []map[string]interface{}) string {
+	var out []string
+	for _, record := range records {
+		out = append(out, toString(record["id"]))
+	}
+	return strings.Join(out, ",")
+}
+
+// toString formats a decoded JSON scalar for comparisons in tests
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// TestFilterRecords tests filtering on field values from the query string
+func TestFilterRecords(t *testing.T) {
+	records := decodeRecords(t, testCustomers)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "No filters", query: "", expected: "CUST-10058429,CUST-20937164,CUST-30128745,CUST-40593217,1"},
+		{name: "Single field", query: "lastName=Chen", expected: "CUST-20937164,CUST-40593217"},
+		{name: "Nested field", query: "address.state=OR", expected: "CUST-10058429,CUST-40593217"},
+		{name: "Fields combine with AND", query: "lastName=Chen&address.state=OR", expected: "CUST-40593217"},
+		{name: "Repeated key means OR", query: "lastName=Garcia&lastName=Johnson", expected: "CUST-10058429,CUST-30128745"},
+		{name: "Numeric id", query: "id=1", expected: "1"},
+		{name: "Numeric id written as float", query: "id=1.0", expected: "1"},
+		{name: "String id", query: "id=CUST-20937164", expected: "CUST-20937164"},
+		{name: "Decimal value", query: "score=1.5", expected: "1"},
+		{name: "Boolean", query: "active=false", expected: "CUST-20937164"},
+		{name: "Null", query: "manager=null", expected: "CUST-30128745"},
+		{name: "Array element", query: "tags=vip", expected: "CUST-10058429"},
+		{name: "Missing field", query: "nickname=Em", expected: ""},
+		{name: "Path into a scalar", query: "lastName.first=C", expected: ""},
+		{name: "Object is not equal to a string", query: "address=Portland", expected: ""},
+		{name: "Reserved parameters are ignored", query: "_sort=id&lastName=Chen", expected: "CUST-20937164,CUST-40593217"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("Invalid test query: %v", err)
+			}
+
+			filters, err := ParseFilters(values)
+			if err != nil {
+				t.Fatalf("ParseFilters() error = %v", err)
+			}
+
+			if got := ids(FilterRecords(records, filters)); got != tt.expected {
+				t.Errorf("Expected ids %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestLookup tests resolving dotted paths in records
+func TestLookup(t *testing.T) {
+	record := decodeRecords(t, testCustomers)[0]
+
+	if value, ok := Lookup(record, "address.city"); !ok || value != "Portland" {
+		t.Errorf("Lookup(address.city) = %v, %v", value, ok)
+	}
+	if _, ok := Lookup(record, "address.zipCode"); ok {
+		t.Error("Expected Lookup(address.zipCode) to find nothing")
+	}
+	if value, ok := Lookup(record, "address"); !ok || value.(map[string]interface{})["state"] != "OR" {
+		t.Errorf("Lookup(address) = %v, %v", value, ok)
+	}
+}
+
+// testProducts is decoded into the records used by the operator tests
+const testProducts = `[
+  {"id": 1, "sku": "TECH-LP001", "title": "Ultra Slim Laptop Pro", "quantity": 42, "price": 1299.99, "released": "2024-03-01", "tags": ["a", "c"], "email": "sales@example.com"},
+  {"id": 2, "sku": "HOME-COF255", "title": "Artisan Coffee Maker", "quantity": 8, "price": 149.95, "released": "2023-11-15", "tags": ["b"]},
+  {"id": 3, "sku": "WEAR-WTC512", "title": "SmartLife Fitness Watch", "quantity": 67, "price": 89.99, "released": "2024-01-20"},
+  {"id": 4, "sku": "TECH-HP100", "title": "Laptop Sleeve", "quantity": 3, "price": 100, "tags": []}
+]`
+
+// TestFilterOperators tests the operator suffixes of filter parameters
+func TestFilterOperators(t *testing.T) {
+	records := decodeRecords(t, testProducts)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "Greater than or equal", query: "price_gte=100", expected: "1,2,4"},
+		{name: "Greater than", query: "price_gt=100", expected: "1,2"},
+		{name: "Less than", query: "quantity_lt=10", expected: "2,4"},
+		{name: "Less than or equal", query: "quantity_lte=8", expected: "2,4"},
+		{name: "Range", query: "price_gte=90&price_lte=150", expected: "2,4"},
+		{name: "Dates compare chronologically", query: "released_gte=2024-01-01", expected: "1,3"},
+		{name: "Like is a case-insensitive substring", query: "title_like=laptop", expected: "1,4"},
+		{name: "Regex", query: "sku_regex=^TECH-", expected: "1,4"},
+		{name: "Regex flags", query: "title_regex=(?i)^smart", expected: "3"},
+		{name: "Not equal", query: "id_ne=3", expected: "1,2,4"},
+		{name: "Not equal to several values", query: "id_ne=3&id_ne=1", expected: "2,4"},
+		{name: "Not equal matches missing fields", query: "email_ne=sales@example.com", expected: "2,3,4"},
+		{name: "In list", query: "tags_in=a,b", expected: "1,2"},
+		{name: "In list of ids", query: "id_in=2,4,9", expected: "2,4"},
+		{name: "Exists", query: "email_exists=true", expected: "1"},
+		{name: "Does not exist", query: "released_exists=false", expected: "4"},
+		{name: "Explicit equality", query: "quantity_eq=42", expected: "1"},
+		{name: "String fields compare lexically", query: "sku_lt=TECH", expected: "2"},
+		{name: "Unknown suffix is part of the field name", query: "unit_price=10", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("Invalid test query: %v", err)
+			}
+
+			filters, err := ParseFilters(values)
+			if err != nil {
+				t.Fatalf("ParseFilters() error = %v", err)
+			}
+
+			if got := ids(FilterRecords(records, filters)); got != tt.expected {
+				t.Errorf("Expected ids %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestParseFiltersErrors tests that malformed filters are rejected
+func TestParseFiltersErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		contains string
+	}{
+		{name: "Invalid regex", query: "sku_regex=[TECH", contains: "invalid regular expression"},
+		{name: "Exists needs a boolean", query: "email_exists=maybe", contains: "true or false"},
+		{name: "Exists takes one value", query: "email_exists=true&email_exists=false", contains: "single value"},
+		{name: "Comparison needs a value", query: "price_gte=", contains: "needs a value"},
+		{name: "Operator without a field", query: "address._like=x", contains: "invalid field path"},
+		{name: "Empty path segment", query: "address..city=Portland", contains: "invalid field path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("Invalid test query: %v", err)
+			}
+
+			_, err = ParseFilters(values)
+			if err == nil {
+				t.Fatal("Expected an error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error to contain %q, got %q", tt.contains, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultLimit is the page size used when _page is given without _limit.
+const DefaultLimit = 10
+
+// MaxParam is the largest value accepted for _page, _limit, _start and _end,
+// and the largest offset a page may start at, so that offsets and the ends
+// of slices can be computed without overflowing.
+const MaxParam = 1_000_000_000
+
+// Page selects a slice of the matching records. It is either page based
+// (_page and _limit) or offset based (_start with _end or _limit).
+type Page struct {
+	// Start is the zero-based index of the first record in the slice.
+	Start int
+
+	// Limit is the maximum number of records in the slice.
+	Limit int
+
+	// Number is the one-based page number for page based requests, or 0 for
+	// offset based ones.
+	Number int
+}
+
+// ParsePage reads the pagination parameters from a query string:
+//   - _page and _limit select page _page of _limit records (10 by default)
+//   - _start and _end select records _start up to, but not including, _end
+//   - _start and _limit select _limit records from _start
+//   - _limit alone selects the first _limit records
+//
+// Parameters:
+//   - values: The parsed query string
+//
+// Returns:
+//   - *Page: The requested slice, or nil if no pagination was requested
+//   - error: An error if a parameter is not a valid number, is larger than
+//     MaxParam or they conflict
+func ParsePage(values url.Values) (*Page, error) {
+	page, hasPage, err := intParam(values, "_page", 1)
+	if err != nil {
+		return nil, err
+	}
+	limit, hasLimit, err := intParam(values, "_limit", 1)
+	if err != nil {
+		return nil, err
+	}
+	start, hasStart, err := intParam(values, "_start", 0)
+	if err != nil {
+		return nil, err
+	}
+	end, hasEnd, err := intParam(values, "_end", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case hasPage && (hasStart || hasEnd):
+		return nil, fmt.Errorf("_page can't be combined with _start or _end")
+	case hasEnd && hasLimit:
+		return nil, fmt.Errorf("_end can't be combined with _limit")
+	case hasPage:
+		if !hasLimit {
+			limit = DefaultLimit
+		}
+		if page-1 > MaxParam/limit {
+			return nil, fmt.Errorf("_page is too large for a _limit of %d", limit)
+		}
+		return &Page{Start: (page - 1) * limit, Limit: limit, Number: page}, nil
+	case hasEnd:
+		if end <= start {
+			return nil, fmt.Errorf("_end must be greater than _start")
+		}
+		return &Page{Start: start, Limit: end - start}, nil
+	case hasLimit:
+		if !hasStart {
+			return &Page{Limit: limit, Number: 1}, nil
+		}
+		return &Page{Start: start, Limit: limit}, nil
+	case hasStart:
+		return nil, fmt.Errorf("_start needs _end or _limit")
+	}
+	return nil, nil
+}
+
+// intParam reads an integer query parameter that must be at least min and at
+// most MaxParam.
+func intParam(values url.Values, name string, min int) (int, bool, error) {
+	s := values.Get(name)
+	if _, ok := values[name]; !ok {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < min || n > MaxParam {
+		return 0, true, fmt.Errorf("%s must be an integer from %d to %d", name, min, MaxParam)
+	}
+	return n, true, nil
+}
+
+// Slice returns the records selected by the page.
+//
+// Parameters:
+//   - records: All matching records
+//
+// Returns:
+//   - []map[string]interface{}: The records on the page, possibly none
+func (p *Page) Slice(records []map[string]interface{}) []map[string]interface{} {
+	if p.Start >= len(records) {
+		return []map[string]interface{}{}
+	}
+	end := p.Start + p.Limit
+	if end > len(records) {
+		end = len(records)
+	}
+	return records[p.Start:end]
+}
+
+// Link builds an RFC 8288 Link header value with first, prev, next and last
+// relations for the page. The links repeat the request URL with only the
+// pagination parameters changed, so filters and sorting carry over. prev and
+// next are left out on the first and last pages.
+//
+// Parameters:
+//   - base: The absolute URL of the current request
+//   - total: The number of matching records across all pages
+//
+// Returns:
+//   - string: The Link header value
+func (p *Page) Link(base *url.URL, total int) string {
+	var links []string
+	add := func(rel string, start int) {
+		u := *base
+		values := u.Query()
+		if p.Number > 0 {
+			values.Del("_start")
+			values.Set("_page", strconv.Itoa(start/p.Limit+1))
+			values.Set("_limit", strconv.Itoa(p.Limit))
+		} else {
+			values.Del("_limit")
+			values.Set("_start", strconv.Itoa(start))
+			values.Set("_end", strconv.Itoa(start+p.Limit))
+		}
+		u.RawQuery = values.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel))
+	}
+
+	// The last page starts at the last multiple of the limit for page based
+	// requests, and holds the final Limit records for offset based ones
+	last := 0
+	if total > 0 {
+		if p.Number > 0 {
+			last = (total - 1) / p.Limit * p.Limit
+		} else if total > p.Limit {
+			last = total - p.Limit
+		}
+	}
+
+	add("first", 0)
+	if p.Start > 0 {
+		prev := p.Start - p.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		if prev > last {
+			prev = last
+		}
+		add("prev", prev)
+	}
+	if p.Start+p.Limit < total {
+		add("next", p.Start+p.Limit)
+	}
+	add("last", last)
+
+	return strings.Join(links, ", ")
+}
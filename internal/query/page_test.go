@@ -0,0 +1,125 @@
+package query
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestParsePage tests reading page and offset parameters from the query string
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected *Page
+	}{
+		{name: "No pagination", query: "title=x", expected: nil},
+		{name: "Page and limit", query: "_page=3&_limit=20", expected: &Page{Start: 40, Limit: 20, Number: 3}},
+		{name: "Default limit", query: "_page=2", expected: &Page{Start: 10, Limit: 10, Number: 2}},
+		{name: "Limit alone", query: "_limit=5", expected: &Page{Limit: 5, Number: 1}},
+		{name: "Start and end", query: "_start=40&_end=60", expected: &Page{Start: 40, Limit: 20}},
+		{name: "Start and limit", query: "_start=5&_limit=3", expected: &Page{Start: 5, Limit: 3}},
+		{name: "End alone", query: "_end=4", expected: &Page{Limit: 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			page, err := ParsePage(values)
+			if err != nil {
+				t.Fatalf("ParsePage() error = %v", err)
+			}
+
+			if (page == nil) != (tt.expected == nil) || page != nil && *page != *tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, page)
+			}
+		})
+	}
+}
+
+// TestParsePageErrors tests that malformed pagination parameters are rejected
+func TestParsePageErrors(t *testing.T) {
+	for _, query := range []string{"_page=0", "_page=x", "_limit=0", "_start=-1&_end=5", "_start=5&_end=5", "_start=5", "_page=1&_start=0", "_end=5&_limit=2", "_limit=1000000001", "_page=1000002&_limit=1000"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := ParsePage(values); err == nil {
+			t.Errorf("Expected an error for %q", query)
+		}
+	}
+}
+
+// TestPageLink tests the first, prev, next and last links of a page
+func TestPageLink(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		total    int
+		expected []string
+	}{
+		{
+			name:  "Middle page",
+			query: "_page=2&_limit=10&title_like=a",
+			total: 35,
+			expected: []string{
+				`</products?_limit=10&_page=1&title_like=a>; rel="first"`,
+				`</products?_limit=10&_page=1&title_like=a>; rel="prev"`,
+				`</products?_limit=10&_page=3&title_like=a>; rel="next"`,
+				`</products?_limit=10&_page=4&title_like=a>; rel="last"`,
+			},
+		},
+		{
+			name:  "First page",
+			query: "_page=1&_limit=10",
+			total: 20,
+			expected: []string{
+				`</products?_limit=10&_page=1>; rel="first"`,
+				`</products?_limit=10&_page=2>; rel="next"`,
+				`</products?_limit=10&_page=2>; rel="last"`,
+			},
+		},
+		{
+			name:  "Past the end",
+			query: "_page=9&_limit=10",
+			total: 15,
+			expected: []string{
+				`</products?_limit=10&_page=1>; rel="first"`,
+				`</products?_limit=10&_page=2>; rel="prev"`,
+				`</products?_limit=10&_page=2>; rel="last"`,
+			},
+		},
+		{
+			name:  "Empty collection",
+			query: "_page=1",
+			total: 0,
+			expected: []string{
+				`</products?_limit=10&_page=1>; rel="first"`,
+				`</products?_limit=10&_page=1>; rel="last"`,
+			},
+		},
+		{
+			name:  "Offset",
+			query: "_start=40&_end=60",
+			total: 70,
+			expected: []string{
+				`</products?_end=20&_start=0>; rel="first"`,
+				`</products?_end=40&_start=20>; rel="prev"`,
+				`</products?_end=80&_start=60>; rel="next"`,
+				`</products?_end=70&_start=50>; rel="last"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, _ := url.Parse("/products?" + tt.query)
+			page, err := ParsePage(base.Query())
+			if err != nil {
+				t.Fatalf("ParsePage() error = %v", err)
+			}
+
+			expected := strings.Join(tt.expected, ", ")
+			if got := page.Link(base, tt.total); got != expected {
+				t.Errorf("Expected\n%s\ngot\n%s", expected, got)
+			}
+		})
+	}
+}
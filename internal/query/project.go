@@ -0,0 +1,141 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Projection selects the fields returned for each record.
+type Projection struct {
+	// Fields are the dotted paths to keep; all fields are kept if empty.
+	Fields []string
+
+	// Exclude are the dotted paths to remove.
+	Exclude []string
+}
+
+// ParseProjection reads the _fields and _exclude parameters, comma-separated
+// lists of dotted field paths such as "id,title,address.city".
+//
+// Parameters:
+//   - values: The parsed query string
+//
+// Returns:
+//   - *Projection: The projection, or nil if neither parameter is given
+//   - error: An error if a parameter contains an empty or invalid field
+func ParseProjection(values url.Values) (*Projection, error) {
+	fields, err := parsePaths(values, "_fields")
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := parsePaths(values, "_exclude")
+	if err != nil {
+		return nil, err
+	}
+	if fields == nil && exclude == nil {
+		return nil, nil
+	}
+	return &Projection{Fields: fields, Exclude: exclude}, nil
+}
+
+// parsePaths reads a comma-separated list of field paths from a parameter.
+func parsePaths(values url.Values, param string) ([]string, error) {
+	var paths []string
+	for _, v := range values[param] {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if !ValidPath(field) {
+				return nil, fmt.Errorf("invalid field %q in %s", field, param)
+			}
+			paths = append(paths, field)
+		}
+	}
+	return paths, nil
+}
+
+// Apply returns a copy of the record with only the selected fields. Fields
+// listed in _fields that the record doesn't have are left out, and nested
+// fields keep their enclosing objects, so "address.city" gives
+// {"address": {"city": ...}}. The record itself is not modified.
+//
+// Parameters:
+//   - record: The record to project
+//
+// Returns:
+//   - map[string]interface{}: The projected record
+func (p *Projection) Apply(record map[string]interface{}) map[string]interface{} {
+	if len(p.Fields) > 0 {
+		projected := make(map[string]interface{})
+		for _, path := range p.Fields {
+			// The ancestor's value is the record's own object, which must
+			// not be written to
+			if hasAncestor(path, p.Fields) {
+				continue
+			}
+			if value, ok := Lookup(record, path); ok {
+				setPath(projected, strings.Split(path, "."), value)
+			}
+		}
+		record = projected
+	}
+
+	for _, path := range p.Exclude {
+		record = removePath(record, strings.Split(path, "."))
+	}
+	return record
+}
+
+// hasAncestor reports whether one of paths is an ancestor of path, such as
+// "address" for "address.city", so path is already selected with it.
+func hasAncestor(path string, paths []string) bool {
+	for _, other := range paths {
+		if strings.HasPrefix(path, other+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// setPath stores value at the path in object, creating nested objects as needed.
+// object and the objects along the path must have been created by the
+// projection, never taken from a record; Apply ensures this by skipping paths
+// whose ancestor is also selected.
+func setPath(object map[string]interface{}, keys []string, value interface{}) {
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := object[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			object[key] = child
+		}
+		object = child
+	}
+	object[keys[len(keys)-1]] = value
+}
+
+// removePath returns object without the field at the path. Objects along the
+// path are copied rather than modified.
+func removePath(object map[string]interface{}, keys []string) map[string]interface{} {
+	value, ok := object[keys[0]]
+	if !ok {
+		return object
+	}
+
+	var child map[string]interface{}
+	if len(keys) > 1 {
+		if child, ok = value.(map[string]interface{}); !ok {
+			return object
+		}
+	}
+
+	copied := make(map[string]interface{}, len(object))
+	for k, v := range object {
+		copied[k] = v
+	}
+	if len(keys) == 1 {
+		delete(copied, keys[0])
+	} else {
+		copied[keys[0]] = removePath(child, keys[1:])
+	}
+	return copied
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"encoding/json"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// TestProjection tests selecting and removing fields of records
+func TestProjection(t *testing.T) {
+	record := decodeRecords(t, `[{
+		"id": 1,
+		"title": "Lamp",
+		"description": "A lamp",
+		"address": {"city": "Portland", "state": "OR", "geo": {"lat": 45.5, "lng": -122.6}},
+		"tags": ["a", "b"]
+	}]`)[0]
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "Fields", query: "_fields=id,title", expected: `{"id":1,"title":"Lamp"}`},
+		{name: "Nested field", query: "_fields=id,address.city", expected: `{"address":{"city":"Portland"},"id":1}`},
+		{name: "Sibling nested fields", query: "_fields=address.city&_fields=address.geo.lat", expected: `{"address":{"city":"Portland","geo":{"lat":45.5}}}`},
+		{name: "Ancestor and nested field", query: "_fields=address,address.city", expected: `{"address":{"city":"Portland","geo":{"lat":45.5,"lng":-122.6},"state":"OR"}}`},
+		{name: "Nested field and ancestor", query: "_fields=address.geo.lat,address.geo", expected: `{"address":{"geo":{"lat":45.5,"lng":-122.6}}}`},
+		{name: "Missing fields are left out", query: "_fields=id,price,tags.0", expected: `{"id":1}`},
+		{name: "Exclude", query: "_exclude=description,address,tags", expected: `{"id":1,"title":"Lamp"}`},
+		{name: "Exclude nested field", query: "_exclude=address.geo,address.state,title.length", expected: `{"address":{"city":"Portland"},"description":"A lamp","id":1,"tags":["a","b"],"title":"Lamp"}`},
+		{name: "Fields then exclude", query: "_fields=id,address&_exclude=address.geo", expected: `{"address":{"city":"Portland","state":"OR"},"id":1}`},
+	}
+
+	original, _ := json.Marshal(record)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			projection, err := ParseProjection(values)
+			if err != nil {
+				t.Fatalf("ParseProjection() error = %v", err)
+			}
+
+			got, _ := json.Marshal(projection.Apply(record))
+			if string(got) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+
+			// The record itself must not be modified
+			if after, _ := json.Marshal(record); string(after) != string(original) {
+				t.Errorf("Record was modified: %s", after)
+			}
+		})
+	}
+}
+
+// TestProjectionConcurrent tests that records shared between requests can be
+// projected at the same time, as the store's records are
+func TestProjectionConcurrent(t *testing.T) {
+	record := decodeRecords(t, `[{"id": 1, "address": {"city": "Portland", "geo": {"lat": 45.5}}}]`)[0]
+	projection := &Projection{Fields: []string{"address", "address.city", "address.geo.lat"}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := json.Marshal(projection.Apply(record)); err != nil {
+				t.Errorf("Marshal() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestParseProjectionErrors tests that invalid field lists are rejected
+func TestParseProjectionErrors(t *testing.T) {
+	for _, query := range []string{"_fields=", "_fields=id,", "_exclude=address..city", "_exclude=.id"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := ParseProjection(values); err == nil {
+			t.Errorf("Expected an error for %q", query)
+		}
+	}
+
+	if projection, err := ParseProjection(url.Values{"title": {"x"}}); projection != nil || err != nil {
+		t.Errorf("Expected no projection, got %+v, %v", projection, err)
+	}
+}
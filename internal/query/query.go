@@ -0,0 +1,280 @@
+// Package query implements the query string features of collection endpoints:
+// filtering records by field values, full-text search, sorting, offset and
+// cursor pagination and field projection. It works on records decoded from
+// JSON, where numbers may be json.Number or float64 values.
+package query
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Query holds the options parsed from the query string of a collection request.
+type Query struct {
+	Filters []Filter
+	Sort    []SortKey
+
+	// Search is the full-text search, or nil.
+	Search *Search
+
+	// Page is the requested slice of the results, or nil for all of them.
+	Page *Page
+
+	// Cursor is the requested page in cursor mode, or nil. Only one of Page
+	// and Cursor is set.
+	Cursor *Cursor
+
+	// Projection selects the fields of each returned record, or nil for all.
+	Projection *Projection
+
+	// IDPaths are the fields identifying a record, which order records with
+	// equal sort values in cursor mode; nil means CursorIDPath.
+	IDPaths []string
+
+	// Expand, if set, is called with the records of the page before they are
+	// projected and returns copies with related data added to them.
+	Expand func(records []map[string]interface{}) []map[string]interface{}
+}
+
+// Result holds the records selected by a query.
+type Result struct {
+	// Records are the records to return.
+	Records []map[string]interface{}
+
+	// Total is the number of matching records before pagination.
+	Total int
+
+	// NextCursor is the cursor of the next page in cursor mode, or "" on the
+	// last page.
+	NextCursor string
+}
+
+// Parse reads the filters, search, sort order, pagination and projection from
+// a query string.
+//
+// Parameters:
+//   - values: The parsed query string
+//
+// Returns:
+//   - *Query: The parsed options
+//   - error: An error describing the first invalid parameter
+func Parse(values url.Values) (*Query, error) {
+	filters, err := ParseFilters(values)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := ParseSort(values)
+	if err != nil {
+		return nil, err
+	}
+
+	search, err := ParseSearch(values)
+	if err != nil {
+		return nil, err
+	}
+
+	projection, err := ParseProjection(values)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{Filters: filters, Search: search, Sort: keys, Projection: projection}
+	if q.Cursor, err = ParseCursor(values, keys); err != nil {
+		return nil, err
+	}
+	if q.Cursor == nil {
+		if q.Page, err = ParsePage(values); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// Apply returns the records selected by the search and filters, in the
+// requested order, limited to the requested page, expanded and projected to
+// the requested fields. Search results are ranked by relevance unless a sort
+// order or cursor is given.
+//
+// Parameters:
+//   - records: The records of the collection
+//   - index: A search index built from records, or nil to search without one
+//
+// Returns:
+//   - *Result: The selected records and pagination details
+func (q *Query) Apply(records []map[string]interface{}, index *Index) *Result {
+	if q.Search != nil {
+		records = q.Search.Filter(records, index)
+	}
+	records = FilterRecords(records, q.Filters)
+	result := &Result{Total: len(records)}
+
+	// Cursor pages are sorted with the id as a tie-breaker
+	if q.Cursor != nil {
+		records, result.NextCursor = q.Cursor.Slice(records, q.Sort, q.IDPaths)
+	} else {
+		if len(q.Sort) > 0 {
+			records = SortRecords(records, q.Sort)
+		}
+		if q.Page != nil {
+			records = q.Page.Slice(records)
+		}
+	}
+
+	highlight := q.Search != nil && q.Search.Highlight
+	if q.Projection != nil || highlight || q.Expand != nil {
+		var shaped []map[string]interface{}
+		if q.Expand != nil {
+			shaped = q.Expand(records)
+		} else {
+			shaped = append([]map[string]interface{}(nil), records...)
+		}
+
+		for i, record := range records {
+			if q.Projection != nil {
+				shaped[i] = q.Projection.Apply(shaped[i])
+			}
+			if highlight {
+				shaped[i] = withField(shaped[i], HighlightField, q.Search.Matches(record))
+			}
+		}
+		records = shaped
+	}
+	result.Records = records
+	return result
+}
+
+// Streamable reports whether the query can be answered one record at a time
+// as records are read, without holding them all: it has no search, sort order
+// or pagination, so only the filters and projection apply. Expand is not
+// taken into account.
+func (q *Query) Streamable() bool {
+	return q.Search == nil && len(q.Sort) == 0 && q.Page == nil && q.Cursor == nil
+}
+
+// Select applies the filters and projection of a streamable query to a single
+// record.
+//
+// Parameters:
+//   - record: The record
+//
+// Returns:
+//   - map[string]interface{}: The projected record, or the record itself without a projection
+//   - bool: True if the record matches the filters
+func (q *Query) Select(record map[string]interface{}) (map[string]interface{}, bool) {
+	if !matchAll(record, q.Filters) {
+		return nil, false
+	}
+	if q.Projection != nil {
+		record = q.Projection.Apply(record)
+	}
+	return record, true
+}
+
+// withField returns a copy of record with an extra field.
+func withField(record map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(record)+1)
+	for k, v := range record {
+		copied[k] = v
+	}
+	copied[key] = value
+	return copied
+}
+
+// Lookup resolves a dotted path such as "address.city" in a record, descending
+// into nested objects.
+//
+// Parameters:
+//   - record: The record to look in
+//   - path: The dotted path of the field
+//
+// Returns:
+//   - interface{}: The value at the path
+//   - bool: True if the path exists in the record
+func Lookup(record map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = record
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// ValidPath reports whether a dotted field path has no empty segments. Paths
+// are checked with it wherever they are read, such as in query parameters and
+// the header of a CSV file.
+func ValidPath(path string) bool {
+	return path != "" && !strings.HasPrefix(path, ".") && !strings.HasSuffix(path, ".") && !strings.Contains(path, "..")
+}
+
+// toFloat converts a decoded JSON number to a float64.
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// scalarString formats a decoded JSON string, number or boolean as it appears
+// in the file, for text matching.
+func scalarString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	if f, ok := toFloat(value); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// equals reports whether a decoded JSON value equals a value given in the
+// query string. The comparison follows the type of the record's value, so
+// "1" matches both the number 1 and the string "1", "true" matches the
+// boolean true and "null" matches null. An array matches if any of its
+// elements does.
+func equals(value interface{}, s string) bool {
+	switch v := value.(type) {
+	case nil:
+		return s == "null"
+	case string:
+		return v == s
+	case bool:
+		b, err := strconv.ParseBool(s)
+		return err == nil && b == v
+	case []interface{}:
+		for _, element := range v {
+			if equals(element, s) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}:
+		return false
+	}
+
+	if f, ok := toFloat(value); ok {
+		n, err := strconv.ParseFloat(s, 64)
+		return err == nil && n == f
+	}
+	return false
+}
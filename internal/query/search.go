@@ -0,0 +1,263 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// HighlightField is the field added to each record by _highlight, listing the
+// paths of the values that matched the search.
+const HighlightField = "_highlight"
+
+// Search is a full-text search over every string value of a record, including
+// those in nested objects and arrays. Matching is case-insensitive.
+type Search struct {
+	// Text is the search text, in lower case.
+	Text string
+
+	// Tokenize splits Text into words that are matched separately; a record
+	// matches if every word is found in one of its values. Otherwise Text is
+	// matched as a single substring.
+	Tokenize bool
+
+	// Highlight adds the matched paths to each returned record.
+	Highlight bool
+
+	// terms are the substrings to look for.
+	terms []string
+}
+
+// ParseSearch reads a full-text search from the q parameter. _tokenize=true
+// matches the words of q separately and _highlight=true lists the matched
+// fields of each record.
+//
+// Parameters:
+//   - values: The parsed query string
+//
+// Returns:
+//   - *Search: The search, or nil if q is not given or empty
+//   - error: An error if _tokenize or _highlight is not a boolean
+func ParseSearch(values url.Values) (*Search, error) {
+	tokenize, err := boolParam(values, "_tokenize")
+	if err != nil {
+		return nil, err
+	}
+	highlight, err := boolParam(values, "_highlight")
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.ToLower(strings.TrimSpace(values.Get("q")))
+	if text == "" {
+		return nil, nil
+	}
+
+	s := &Search{Text: text, Tokenize: tokenize, Highlight: highlight}
+	if tokenize {
+		s.terms = tokens(text)
+	}
+	if len(s.terms) == 0 {
+		s.terms = []string{text}
+	}
+	return s, nil
+}
+
+// boolParam reads an optional boolean query parameter.
+func boolParam(values url.Values, name string) (bool, error) {
+	if _, ok := values[name]; !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(values.Get(name))
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+	return b, nil
+}
+
+// Matches returns the dotted paths of the string values of a record that
+// contain one of the search terms, in sorted order. Array elements are
+// addressed by their index, e.g. "tags.1".
+//
+// Parameters:
+//   - record: The record to search
+//
+// Returns:
+//   - []string: The matched paths, or nil if the record doesn't match
+func (s *Search) Matches(record map[string]interface{}) []string {
+	var paths []string
+	found := make([]bool, len(s.terms))
+	walkStrings(record, "", func(path, value string) {
+		value = strings.ToLower(value)
+		matched := false
+		for i, term := range s.terms {
+			if strings.Contains(value, term) {
+				found[i], matched = true, true
+			}
+		}
+		if matched {
+			paths = append(paths, path)
+		}
+	})
+
+	for _, ok := range found {
+		if !ok {
+			return nil
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Filter returns the records that match the search, ranked by the number of
+// matching fields; records with the same number keep their original order.
+//
+// Parameters:
+//   - records: The records to search
+//   - index: An index built from records to narrow the search, or nil
+//
+// Returns:
+//   - []map[string]interface{}: The matching records
+func (s *Search) Filter(records []map[string]interface{}, index *Index) []map[string]interface{} {
+	candidates, ok := index.Candidates(s.Text)
+	if !ok {
+		candidates = nil
+		for i := range records {
+			candidates = append(candidates, i)
+		}
+	}
+
+	type match struct {
+		record map[string]interface{}
+		count  int
+	}
+	var matches []match
+	for _, i := range candidates {
+		if paths := s.Matches(records[i]); paths != nil {
+			matches = append(matches, match{record: records[i], count: len(paths)})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].count > matches[j].count
+	})
+
+	matched := make([]map[string]interface{}, len(matches))
+	for i, m := range matches {
+		matched[i] = m.record
+	}
+	return matched
+}
+
+// walkStrings calls f with the path and value of every string in value.
+func walkStrings(value interface{}, path string, f func(path, value string)) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch v := value.(type) {
+	case string:
+		f(path, v)
+	case map[string]interface{}:
+		for key, child := range v {
+			walkStrings(child, join(key), f)
+		}
+	case []interface{}:
+		for i, child := range v {
+			walkStrings(child, join(strconv.Itoa(i)), f)
+		}
+	}
+}
+
+// tokens splits lower-case text into runs of letters and digits.
+func tokens(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Index is an inverted index from the words in a set of records to the
+// positions of the records containing them. It narrows a search down to a few
+// candidate records, so only those need to be checked in full. An Index must
+// be rebuilt when the records change.
+type Index struct {
+	postings map[string][]int
+	words    []string
+}
+
+// NewIndex builds an index over the string values of records.
+//
+// Parameters:
+//   - records: The records to index
+//
+// Returns:
+//   - *Index: The index
+func NewIndex(records []map[string]interface{}) *Index {
+	index := &Index{postings: make(map[string][]int)}
+	for i, record := range records {
+		walkStrings(record, "", func(_, value string) {
+			for _, word := range tokens(strings.ToLower(value)) {
+				postings := index.postings[word]
+				if n := len(postings); n == 0 || postings[n-1] != i {
+					index.postings[word] = append(postings, i)
+				}
+			}
+		})
+	}
+
+	index.words = make([]string, 0, len(index.postings))
+	for word := range index.postings {
+		index.words = append(index.words, word)
+	}
+	sort.Strings(index.words)
+	return index
+}
+
+// Candidates returns the positions of the records that may contain text.
+// Every word of text must be part of a word in a matching record, so the
+// records holding the rarest word are a superset of the matches; the caller
+// checks each candidate in full.
+//
+// Parameters:
+//   - text: The lower-case search text
+//
+// Returns:
+//   - []int: The candidate positions in ascending order
+//   - bool: False if the index can't narrow the search, because it is nil or
+//     text has no words
+func (ix *Index) Candidates(text string) ([]int, bool) {
+	terms := tokens(text)
+	if ix == nil || len(terms) == 0 {
+		return nil, false
+	}
+
+	// Find the term whose matching words cover the fewest records
+	var best []string
+	bestSize := -1
+	for _, term := range terms {
+		var words []string
+		size := 0
+		for _, word := range ix.words {
+			if strings.Contains(word, term) {
+				words = append(words, word)
+				size += len(ix.postings[word])
+			}
+		}
+		if bestSize < 0 || size < bestSize {
+			best, bestSize = words, size
+		}
+	}
+
+	candidates := make([]int, 0, bestSize)
+	for _, word := range best {
+		candidates = append(candidates, ix.postings[word]...)
+	}
+	sort.Ints(candidates)
+	return slices.Compact(candidates), true
+}
@@ -0,0 +1,96 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// testPeople is decoded into the records used by the search tests
+const testPeople = `[
+  {"id": 1, "name": "Emily Chen", "address": {"city": "Portland", "state": "OR"}, "notes": "Prefers Portland roast"},
+  {"id": 2, "name": "Marcus Lee", "address": {"city": "Seattle", "state": "WA"}, "tags": ["portland-office", "vip"]},
+  {"id": 3, "name": "Ana Portlandia", "address": {"city": "Austin", "state": "TX"}},
+  {"id": 4, "name": "Tom Ng", "address": {"city": "Denver", "state": "CO"}, "age": 40},
+  {"id": 5, "name": "Chen Wei", "address": {"city": "Portland", "state": "ME"}}
+]`
+
+// TestSearch tests full-text search with and without an index
+func TestSearch(t *testing.T) {
+	records := decodeRecords(t, testPeople)
+	index := NewIndex(records)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "Ranked by matching fields", query: "q=portland", expected: "1,2,3,5"},
+		{name: "Case-insensitive", query: "q=PORTLAND", expected: "1,2,3,5"},
+		{name: "Phrase", query: "q=emily+chen", expected: "1"},
+		{name: "Phrase across punctuation", query: "q=portland-off", expected: "2"},
+		{name: "Substring of a word", query: "q=landi", expected: "3"},
+		{name: "Tokenized words must all match", query: "q=chen+portland&_tokenize=true", expected: "1,5"},
+		{name: "Untokenized phrase", query: "q=chen+portland", expected: ""},
+		{name: "Numbers are not searched", query: "q=40", expected: ""},
+		{name: "Combined with filters", query: "q=portland&address.state=OR", expected: "1"},
+		{name: "Sort overrides ranking", query: "q=portland&_sort=-id", expected: "5,3,2,1"},
+		{name: "No words", query: "q=-", expected: "2"},
+	}
+
+	for _, tt := range tests {
+		for _, ix := range []*Index{nil, index} {
+			t.Run(fmt.Sprintf("%s/indexed=%v", tt.name, ix != nil), func(t *testing.T) {
+				values, _ := url.ParseQuery(tt.query)
+				q, err := Parse(values)
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+
+				if got := ids(q.Apply(records, ix).Records); got != tt.expected {
+					t.Errorf("Expected ids %q, got %q", tt.expected, got)
+				}
+			})
+		}
+	}
+}
+
+// TestSearchHighlight tests listing the matched paths of each record
+func TestSearchHighlight(t *testing.T) {
+	records := decodeRecords(t, testPeople)
+
+	q, err := Parse(url.Values{"q": {"portland"}, "_highlight": {"true"}, "_fields": {"id"}})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	result := q.Apply(records, nil)
+	expected := [][]string{{"address.city", "notes"}, {"tags.0"}, {"name"}, {"address.city"}}
+	for i, record := range result.Records {
+		if got := record[HighlightField]; !reflect.DeepEqual(got, expected[i]) {
+			t.Errorf("Expected highlight %v for record %v, got %v", expected[i], record["id"], got)
+		}
+		if len(record) != 2 {
+			t.Errorf("Expected only id and %s, got %v", HighlightField, record)
+		}
+	}
+
+	if _, ok := records[0][HighlightField]; ok {
+		t.Error("Expected the stored record to be unchanged")
+	}
+}
+
+// TestParseSearchErrors tests that invalid search options are rejected
+func TestParseSearchErrors(t *testing.T) {
+	for _, query := range []string{"q=a&_tokenize=maybe", "q=a&_highlight=2"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := ParseSearch(values); err == nil {
+			t.Errorf("Expected an error for %q", query)
+		}
+	}
+
+	if s, err := ParseSearch(url.Values{"q": {"  "}}); s != nil || err != nil {
+		t.Errorf("Expected no search for blank text, got %+v, %v", s, err)
+	}
+}
@@ -0,0 +1,208 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortKey orders records by the field at Path, descending if Desc is set.
+type SortKey struct {
+	Path string
+	Desc bool
+}
+
+// String returns the key in its query string form, e.g. "-price".
+func (k SortKey) String() string {
+	if k.Desc {
+		return "-" + k.Path
+	}
+	return k.Path
+}
+
+// ParseSort reads the sort order from the _sort parameter, a comma-separated
+// list of dotted field paths such as "price,-title". A leading '-' sorts that
+// field in descending order and an optional '+' in ascending order.
+//
+// Parameters:
+//   - values: The parsed query string
+//
+// Returns:
+//   - []SortKey: The sort keys, most significant first; nil if no order is requested
+//   - error: An error if the parameter contains an empty or invalid field
+func ParseSort(values url.Values) ([]SortKey, error) {
+	var keys []SortKey
+	for _, v := range values["_sort"] {
+		for _, field := range strings.Split(v, ",") {
+			key := SortKey{Path: strings.TrimSpace(field)}
+			switch {
+			case strings.HasPrefix(key.Path, "-"):
+				key.Path, key.Desc = key.Path[1:], true
+			case strings.HasPrefix(key.Path, "+"):
+				key.Path = key.Path[1:]
+			}
+			if !ValidPath(key.Path) {
+				return nil, fmt.Errorf("invalid field %q in _sort", field)
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// SortRecords returns a copy of records ordered by the sort keys. The sort is
+// stable, so records that compare equal keep their original order. Values are
+// compared by type: numbers numerically, ISO-8601 dates chronologically and
+// other strings lexically. Records missing a field sort after all records that
+// have it, in either direction.
+//
+// Parameters:
+//   - records: The records to sort
+//   - keys: The sort keys, most significant first
+//
+// Returns:
+//   - []map[string]interface{}: The sorted records
+func SortRecords(records []map[string]interface{}, keys []SortKey) []map[string]interface{} {
+	sorted := append([]map[string]interface{}(nil), records...)
+	if len(keys) == 0 {
+		return sorted
+	}
+
+	// Extract and convert every sort value once rather than on each comparison
+	type entry struct {
+		record map[string]interface{}
+		values []sortValue
+	}
+	entries := make([]entry, len(sorted))
+	for i, record := range sorted {
+		values := make([]sortValue, len(keys))
+		for k, key := range keys {
+			values[k] = newSortValue(record, key.Path)
+		}
+		entries[i] = entry{record: record, values: values}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		for k, key := range keys {
+			if c := compareSortValues(entries[i].values[k], entries[j].values[k], key.Desc); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	for i := range entries {
+		sorted[i] = entries[i].record
+	}
+	return sorted
+}
+
+// Ranks order values of different types: numbers, then dates, then other
+// strings, then booleans, null, objects and arrays, and finally missing fields.
+const (
+	rankNumber = iota
+	rankTime
+	rankString
+	rankBool
+	rankNull
+	rankOther
+	rankMissing
+)
+
+// sortValue is a record's value for a sort key, converted for comparison.
+type sortValue struct {
+	rank int
+	num  float64
+	time time.Time
+	str  string
+}
+
+// newSortValue extracts and converts the value at path for sorting.
+func newSortValue(record map[string]interface{}, path string) sortValue {
+	value, ok := Lookup(record, path)
+	if !ok {
+		return sortValue{rank: rankMissing}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return sortValue{rank: rankNull}
+	case string:
+		if t, ok := parseTime(v); ok {
+			return sortValue{rank: rankTime, time: t}
+		}
+		return sortValue{rank: rankString, str: v}
+	case bool:
+		if v {
+			return sortValue{rank: rankBool, num: 1}
+		}
+		return sortValue{rank: rankBool}
+	}
+
+	if f, ok := toFloat(value); ok {
+		return sortValue{rank: rankNumber, num: f}
+	}
+	return sortValue{rank: rankOther}
+}
+
+// compareSortValues returns -1, 0 or 1 as a sorts before, with or after b.
+// Missing values sort last regardless of direction.
+func compareSortValues(a, b sortValue, desc bool) int {
+	if a.rank == rankMissing || b.rank == rankMissing {
+		return compareInts(a.rank, b.rank)
+	}
+
+	var c int
+	if a.rank != b.rank {
+		c = compareInts(a.rank, b.rank)
+	} else {
+		switch a.rank {
+		case rankNumber, rankBool:
+			c = compareFloats(a.num, b.num)
+		case rankTime:
+			c = a.time.Compare(b.time)
+		case rankString:
+			c = strings.Compare(a.str, b.str)
+		}
+	}
+
+	if desc {
+		return -c
+	}
+	return c
+}
+
+// compareInts returns -1, 0 or 1 as a is less than, equal to or greater than b.
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// timeLayouts are the ISO-8601 forms recognized as dates when sorting.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseTime parses an ISO-8601 date or date-time.
+func parseTime(s string) (time.Time, bool) {
+	// Cheap check before trying the layouts: dates start with YYYY-MM-DD
+	if len(s) < 10 || s[4] != '-' || s[7] != '-' {
+		return time.Time{}, false
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
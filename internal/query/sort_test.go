@@ -0,0 +1,64 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+)
+
+// testEvents is decoded into the records used by the sort tests
+const testEvents = `[
+  {"id": 1, "title": "beta", "price": 20, "date": "2024-03-01T09:00:00Z", "group": "b"},
+  {"id": 2, "title": "Alpha", "price": 3, "date": "2024-03-01", "group": "a"},
+  {"id": 3, "title": "gamma", "price": 100, "date": "2023-12-31T23:59:59+02:00", "group": "b"},
+  {"id": 4, "title": "delta", "group": "a"},
+  {"id": 5, "title": "alpha", "price": 20.5, "date": "2024-02-29", "group": "a"},
+  {"id": 6, "title": "epsilon", "price": "n/a", "group": "b"}
+]`
+
+// TestSortRecords tests ordering records by one or more fields
+func TestSortRecords(t *testing.T) {
+	records := decodeRecords(t, testEvents)
+
+	tests := []struct {
+		name     string
+		sort     string
+		expected string
+	}{
+		{name: "Numbers sort numerically", sort: "price", expected: "2,1,5,3,6,4"},
+		{name: "Descending", sort: "-price", expected: "6,3,5,1,2,4"},
+		{name: "Dates sort chronologically", sort: "date", expected: "3,5,2,1,4,6"},
+		{name: "Strings sort lexically", sort: "title", expected: "2,5,1,4,6,3"},
+		{name: "Multiple keys", sort: "group,-price", expected: "5,2,4,6,3,1"},
+		{name: "Stable for equal keys", sort: "group", expected: "2,4,5,1,3,6"},
+		{name: "Explicit ascending", sort: "+group,id", expected: "2,4,5,1,3,6"},
+		{name: "Missing fields sort last when descending", sort: "-date", expected: "1,2,5,3,4,6"},
+		{name: "Nested path", sort: "missing.path,id", expected: "1,2,3,4,5,6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseSort(url.Values{"_sort": {tt.sort}})
+			if err != nil {
+				t.Fatalf("ParseSort() error = %v", err)
+			}
+
+			if got := ids(SortRecords(records, keys)); got != tt.expected {
+				t.Errorf("Expected ids %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	// The input must not be reordered
+	if got := ids(records); got != "1,2,3,4,5,6" {
+		t.Errorf("Expected the input order to be unchanged, got %q", got)
+	}
+}
+
+// TestParseSortErrors tests that malformed sort parameters are rejected
+func TestParseSortErrors(t *testing.T) {
+	for _, sort := range []string{"", "price,", "-", "address..city"} {
+		if _, err := ParseSort(url.Values{"_sort": {sort}}); err == nil {
+			t.Errorf("Expected an error for _sort=%q", sort)
+		}
+	}
+}
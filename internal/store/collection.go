@@ -0,0 +1,881 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RAshkettle/getter/internal/files"
+	"github.com/RAshkettle/getter/internal/ids"
+	"github.com/RAshkettle/getter/internal/query"
+)
+
+// Collection is an in-memory copy of an array of records in a data file.
+// The file either is the array itself, or a JSON object with one or more
+// properties holding arrays, for example {"products": [...]}. Data files are
+// JSON or YAML documents, CSV and TSV tables whose rows are the records, or
+// NDJSON files holding a record per line; changes are written back in the
+// file's format.
+//
+// A file holding an object without any array of records, such as
+// {"theme": "dark"}, is a singleton: a single resource rather than a
+// collection. Its object is read with Object and changed with Replace, and
+// the record operations return ErrSingleton.
+//
+// Records are identified by the value of their id field, "id" unless another
+// field, or several fields forming a composite key, is set with
+// Store.SetIDFields. See RecordID.
+//
+// Records returned by a Collection are shared with it and must not be modified;
+// changes are made through Insert, Update, Delete and Clear, which replace
+// records rather than modifying them in place.
+type Collection struct {
+	name string
+	file string
+	path string
+	dir  string
+
+	// format is the format of the data file, such as files.FormatJSON.
+	format string
+
+	// columns is the header row of a CSV or TSV file, kept so the file's
+	// column order survives writes.
+	columns []string
+
+	// fixedKey is the key of the array given in the collection name, or ""
+	// to choose the array when the file is loaded.
+	fixedKey string
+
+	// idFields are the fields whose values identify a record.
+	idFields []string
+
+	// store is the store the collection belongs to, if any.
+	store *Store
+
+	// loadOnce loads the data file when Store.Collection first returns the
+	// collection, and loadErr holds the result for every caller.
+	loadOnce sync.Once
+	loadErr  error
+
+	mu        sync.RWMutex
+	data      map[string]interface{}
+	key       string
+	singleton bool
+	records   []map[string]interface{}
+	index     map[string]int
+
+	// text is the full-text search index over records. It is built on first
+	// use and dropped whenever the records change.
+	text *query.Index
+
+	// modTime and size identify the version of the file that was loaded, so
+	// changes made by other processes are picked up before writing.
+	modTime time.Time
+	size    int64
+}
+
+// Name returns the name of the collection.
+func (c *Collection) Name() string {
+	return c.name
+}
+
+// Path returns the path of the data file backing the collection.
+func (c *Collection) Path() string {
+	return c.path
+}
+
+// Format returns the format of the data file backing the collection, such as
+// files.FormatJSON, files.FormatYAML or files.FormatCSV.
+func (c *Collection) Format() string {
+	return c.format
+}
+
+// IDFields returns the fields whose values identify a record of the
+// collection: a single field such as "id", or several for a composite key.
+// The returned slice must not be modified.
+func (c *Collection) IDFields() []string {
+	return c.idFields
+}
+
+// Key returns the property of the file's top-level object that holds the
+// records, or "" if the file is a top-level array.
+func (c *Collection) Key() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.key
+}
+
+// HasArray reports whether the top-level object of the collection's data file
+// has an array under key, which can be used as the collection "<file>/<key>".
+//
+// Parameters:
+//   - key: The property name
+//
+// Returns:
+//   - bool: True if the property holds an array
+func (c *Collection) HasArray(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.singleton && isRecordArray(c.data[key])
+}
+
+// IsSingleton reports whether the data file holds a single object rather
+// than records.
+func (c *Collection) IsSingleton() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.singleton
+}
+
+// Object returns the object of a singleton. It is shared with the collection
+// and must not be modified.
+//
+// Returns:
+//   - map[string]interface{}: The object, or nil if the collection is not a singleton
+func (c *Collection) Object() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.singleton {
+		return nil
+	}
+	return c.data
+}
+
+// Replace replaces the object of a singleton by the result of update and
+// writes the file.
+//
+// Parameters:
+//   - update: Computes the new object from the current one; it must not modify the current object
+//
+// Returns:
+//   - map[string]interface{}: The stored object
+//   - error: The error returned by update, or an error if the collection is
+//     not a singleton or writing fails
+func (c *Collection) Replace(update func(current map[string]interface{}) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	var object map[string]interface{}
+	err := c.write(func() error {
+		if !c.singleton {
+			return fmt.Errorf("%s is a collection, not a single object", c.name)
+		}
+		updated, err := update(c.data)
+		if err != nil {
+			return err
+		}
+		c.data = updated
+		object = updated
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// Len returns the number of records in the collection.
+func (c *Collection) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.records)
+}
+
+// Records returns the records of the collection in file order. The returned
+// slice is a copy, but the records themselves are shared and must not be modified.
+func (c *Collection) Records() []map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]map[string]interface{}(nil), c.records...)
+}
+
+// Indexed returns the records of the collection, like Records, together with a
+// full-text search index over them. The index is built on first use after the
+// collection is loaded, reloaded or changed.
+//
+// Returns:
+//   - []map[string]interface{}: A copy of the records slice
+//   - *query.Index: The search index, whose positions refer to the returned slice
+func (c *Collection) Indexed() ([]map[string]interface{}, *query.Index) {
+	c.mu.RLock()
+	if c.text != nil {
+		defer c.mu.RUnlock()
+		return append([]map[string]interface{}(nil), c.records...), c.text
+	}
+	c.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.text == nil {
+		c.text = query.NewIndex(c.records)
+	}
+	return append([]map[string]interface{}(nil), c.records...), c.text
+}
+
+// Document returns the records in the shape of the data file: for a file
+// holding a single object, its top-level object with the records replaced by
+// the given ones; for a top-level array or a collection named by its key, just
+// the array. It is used to answer requests in the same shape as the file itself.
+//
+// Parameters:
+//   - records: The records to place under the collection's key
+//
+// Returns:
+//   - interface{}: The array of records, or a shallow copy of the file's top-level object
+func (c *Collection) Document(records []map[string]interface{}) interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.singleton {
+		return c.data
+	}
+	if c.data == nil || c.fixedKey != "" {
+		return toValues(records)
+	}
+
+	doc := make(map[string]interface{}, len(c.data))
+	for key, value := range c.data {
+		doc[key] = value
+	}
+	doc[c.key] = toValues(records)
+	return doc
+}
+
+// Get returns the record with the given id.
+//
+// Parameters:
+//   - id: The record id, formatted as a string
+//
+// Returns:
+//   - map[string]interface{}: The record
+//   - bool: True if a record with the id exists
+func (c *Collection) Get(id string) (map[string]interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	i, ok := c.index[id]
+	if !ok {
+		return nil, false
+	}
+	return c.records[i], true
+}
+
+// IDs returns the ids of all records that have one, as stored in the id
+// field. Collections with a composite key have none.
+func (c *Collection) IDs() []interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.idsLocked()
+}
+
+// Insert appends a record to the collection and writes the file. A record
+// without an id is given one by generator; records of a collection with a
+// composite key must have a value for each of its fields. The record of an
+// NDJSON collection is appended to the file as a new line rather than
+// rewriting the file.
+//
+// Parameters:
+//   - record: The new record; it is stored as is and must not be modified afterwards
+//   - generator: The generator for missing ids
+//
+// Returns:
+//   - map[string]interface{}: The stored record
+//   - error: ErrDuplicateID if the id is taken, ErrMissingID if part of a
+//     composite key is missing, or an error if generating the id or writing fails
+func (c *Collection) Insert(record map[string]interface{}, generator ids.Generator) (map[string]interface{}, error) {
+	persist := c.save
+	if c.format == files.FormatNDJSON {
+		persist = func() error { return c.appendLocked(record) }
+	}
+
+	err := c.writeWith(func() error {
+		if c.singleton {
+			return ErrSingleton
+		}
+		id, err := c.assignID(record, generator, c.idsLocked)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := c.index[id]; ok {
+			return ErrDuplicateID
+		}
+
+		c.records = append(c.records, record)
+		c.index[id] = len(c.records) - 1
+		return nil
+	}, persist)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// assignID returns the id of a new record, first giving the record one from
+// generator if it has none. existing is only called to generate an id.
+func (c *Collection) assignID(record map[string]interface{}, generator ids.Generator, existing func() []interface{}) (string, error) {
+	if id := c.RecordID(record); id != "" {
+		return id, nil
+	}
+	if len(c.idFields) > 1 {
+		return "", ErrMissingID
+	}
+	generated, err := generator.Next(existing())
+	if err != nil {
+		return "", fmt.Errorf("error generating id: %w", err)
+	}
+	record[c.idFields[0]] = generated
+	return c.RecordID(record), nil
+}
+
+// Update replaces the record with the given id by the result of update and
+// writes the file. The new record always keeps the id fields of the current one.
+//
+// Parameters:
+//   - id: The record id
+//   - update: Computes the new record from the current one; it must not modify the current record
+//
+// Returns:
+//   - map[string]interface{}: The stored record
+//   - error: ErrRecordNotFound if there is no such record, the error returned by
+//     update, or an error if writing fails
+func (c *Collection) Update(id string, update func(current map[string]interface{}) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	var record map[string]interface{}
+	err := c.write(func() error {
+		if c.singleton {
+			return ErrSingleton
+		}
+		i, ok := c.index[id]
+		if !ok {
+			return ErrRecordNotFound
+		}
+
+		current := c.records[i]
+		updated, err := update(current)
+		if err != nil {
+			return err
+		}
+		for _, field := range c.idFields {
+			updated[field] = current[field]
+		}
+
+		c.records[i] = updated
+		record = updated
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Delete removes the record with the given id and writes the file.
+//
+// Parameters:
+//   - id: The record id
+//
+// Returns:
+//   - error: ErrRecordNotFound if there is no such record, or an error if writing fails
+func (c *Collection) Delete(id string) error {
+	return c.write(func() error {
+		if c.singleton {
+			return ErrSingleton
+		}
+		i, ok := c.index[id]
+		if !ok {
+			return ErrRecordNotFound
+		}
+
+		c.records = append(c.records[:i:i], c.records[i+1:]...)
+		c.reindex()
+		return nil
+	})
+}
+
+// Clear removes all records from the collection and writes the file,
+// leaving an empty array under the collection's key. A singleton is left
+// as an empty object.
+//
+// Returns:
+//   - error: An error if writing fails
+func (c *Collection) Clear() error {
+	return c.write(func() error {
+		if c.singleton {
+			c.data = map[string]interface{}{}
+		}
+		c.records = nil
+		c.reindex()
+		return nil
+	})
+}
+
+// removeKey deletes the collection's array from the top-level object of its
+// data file, keeping the file's other members. The collection must be
+// forgotten afterwards, as it no longer matches the file.
+func (c *Collection) removeKey() error {
+	return c.writeLocked(func() error { return nil }, func() error {
+		data := make(map[string]interface{}, len(c.data))
+		for key, value := range c.data {
+			if key != c.key {
+				data[key] = value
+			}
+		}
+
+		content, _, err := c.encode(data)
+		if err != nil {
+			return err
+		}
+		return files.WriteFileAtomic(c.path, content, 0644)
+	})
+}
+
+// write applies change to the collection and saves it to disk, then refreshes
+// the other collections backed by the same file.
+func (c *Collection) write(change func() error) error {
+	return c.writeWith(change, c.save)
+}
+
+// writeWith is write with persist in place of save, for changes that can be
+// written to disk without rewriting the whole file.
+func (c *Collection) writeWith(change, persist func() error) error {
+	if err := c.writeLocked(change, persist); err != nil {
+		return err
+	}
+	if c.store != nil {
+		c.store.syncSiblings(c)
+	}
+	return nil
+}
+
+// writeLocked applies change to the collection and saves it to disk while
+// holding the collection's write lock and an advisory lock on the data
+// directory. If the file was changed by another process since it was loaded,
+// it is reloaded first so those changes aren't overwritten. If change or
+// persisting the change fails, the in-memory collection is restored from the
+// file.
+func (c *Collection) writeLocked(change, persist func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Whatever happens the records may change, so the search index is stale
+	c.text = nil
+
+	return withDirLock(c.dir, func() error {
+		info, err := os.Stat(c.path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%w: %s", ErrNotFound, c.name)
+			}
+			return err
+		}
+		if !info.ModTime().Equal(c.modTime) || info.Size() != c.size {
+			if err := c.loadLocked(); err != nil {
+				return err
+			}
+		}
+
+		data, records := c.data, c.records
+		if err := change(); err != nil {
+			c.data, c.records = data, records
+			c.reindex()
+			return err
+		}
+
+		if err := persist(); err != nil {
+			// Resynchronize with whatever is on disk
+			if loadErr := c.loadLocked(); loadErr != nil {
+				return fmt.Errorf("%w (reloading %s: %v)", err, c.name, loadErr)
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// load reads the collection from its data file.
+func (c *Collection) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.loadLocked()
+}
+
+// loadLocked reads and decodes the data file and locates the array of records
+// inside it. A top-level array is used as is. In an object, the array under
+// the collection's fixed key is used if it has one; otherwise keys are
+// inspected in sorted order so the same array is chosen on every load: the
+// first non-empty array wins, falling back to the first empty array so records
+// can still be added to it. The caller must hold c.mu.
+func (c *Collection) loadLocked() error {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNotFound, c.name)
+		}
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w: %s", ErrNotFound, c.name)
+	}
+
+	content, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+
+	doc, columns, err := c.decode(content)
+	if err != nil {
+		return fmt.Errorf("invalid %s in file %s: %w", strings.ToUpper(c.format), c.path, err)
+	}
+
+	var data map[string]interface{}
+	var key string
+	var values []interface{}
+	var singleton bool
+	switch v := doc.(type) {
+	case []interface{}:
+		if c.fixedKey != "" {
+			return fmt.Errorf("%w: %s", ErrNotFound, c.name)
+		}
+		values = v
+	case map[string]interface{}:
+		data = v
+		if c.fixedKey == "" && !hasRecordArray(data) {
+			singleton = true
+			break
+		}
+		if key, values, err = c.chooseArray(data); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("no array of records found in file %s", c.path)
+	}
+
+	records := make([]map[string]interface{}, 0, len(values))
+	for i, value := range values {
+		record, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("record %d in file %s is not a JSON object", i, c.path)
+		}
+		records = append(records, record)
+	}
+
+	c.data = data
+	c.key = key
+	c.singleton = singleton
+	c.columns = columns
+	c.records = records
+	c.modTime = info.ModTime()
+	c.size = info.Size()
+	c.reindex()
+	c.text = nil
+	return nil
+}
+
+// chooseArray locates the array of records in the top-level object of a data
+// file, as described for loadLocked. Only arrays of objects are considered.
+func (c *Collection) chooseArray(data map[string]interface{}) (string, []interface{}, error) {
+	if c.fixedKey != "" {
+		if !isRecordArray(data[c.fixedKey]) {
+			return "", nil, fmt.Errorf("%w: %s", ErrNotFound, c.name)
+		}
+		return c.fixedKey, data[c.fixedKey].([]interface{}), nil
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Find the array of records (we don't know the key name in advance)
+	var key string
+	var found bool
+	for _, k := range keys {
+		if !isRecordArray(data[k]) {
+			continue
+		}
+		value := data[k].([]interface{})
+		if !found || len(value) > 0 {
+			key = k
+			found = true
+		}
+		if len(value) > 0 {
+			break
+		}
+	}
+
+	if !found {
+		return "", nil, fmt.Errorf("no array of records found in file %s", c.path)
+	}
+	return key, data[key].([]interface{}), nil
+}
+
+// save writes the collection back to its data file, using two-space
+// indentation to match the layout of hand-written data files. The file is
+// replaced atomically, so it is never left half-written. The caller must
+// hold c.mu and the directory lock.
+func (c *Collection) save() error {
+	var doc interface{} = toValues(c.records)
+	data := c.data
+	if c.singleton {
+		doc = data
+	} else if c.data != nil {
+		data = make(map[string]interface{}, len(c.data))
+		for key, value := range c.data {
+			data[key] = value
+		}
+		data[c.key] = doc
+		doc = data
+	}
+
+	content, columns, err := c.encode(doc)
+	if err != nil {
+		return err
+	}
+
+	if err := files.WriteFileAtomic(c.path, content, 0644); err != nil {
+		return err
+	}
+	c.data = data
+	c.columns = columns
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+	c.modTime = info.ModTime()
+	c.size = info.Size()
+	return nil
+}
+
+// reindex rebuilds the id index from the records. If several records share
+// an id, the first one wins, matching a linear search.
+func (c *Collection) reindex() {
+	c.index = make(map[string]int, len(c.records))
+	for i, record := range c.records {
+		id := c.RecordID(record)
+		if _, ok := c.index[id]; id != "" && !ok {
+			c.index[id] = i
+		}
+	}
+}
+
+// isRecordArray reports whether value is an array of objects, which can hold
+// the records of a collection. Empty arrays qualify so records can be added.
+func isRecordArray(value interface{}) bool {
+	values, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, v := range values {
+		if _, ok := v.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// hasRecordArray reports whether any member of an object is an array of records.
+func hasRecordArray(data map[string]interface{}) bool {
+	for _, value := range data {
+		if isRecordArray(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// idsLocked is IDs for callers that already hold c.mu.
+func (c *Collection) idsLocked() []interface{} {
+	if len(c.idFields) > 1 {
+		return nil
+	}
+	existing := make([]interface{}, 0, len(c.records))
+	for _, record := range c.records {
+		if id, ok := record[c.idFields[0]]; ok && id != nil {
+			existing = append(existing, id)
+		}
+	}
+	return existing
+}
+
+// withDirLock runs f while holding an advisory lock on the data directory,
+// so writes by other getter processes serving the same directory don't interleave.
+func withDirLock(dir string, f func() error) error {
+	lock, err := files.LockPath(dir)
+	if err != nil {
+		return fmt.Errorf("error locking data directory: %w", err)
+	}
+	defer lock.Unlock()
+	return f()
+}
+
+// RecordID returns the id of a record formatted as a string, or an empty
+// string if the record has no id. IDs are compared in this form so numeric
+// and string identifiers are both supported. The values of a composite key
+// are joined with commas, in the order of the key's fields, as in the URL
+// /orderLines/1001,2.
+//
+// Parameters:
+//   - record: The record
+//
+// Returns:
+//   - string: The id, or "" if any of the id fields is missing or null
+func (c *Collection) RecordID(record map[string]interface{}) string {
+	parts := make([]string, len(c.idFields))
+	for i, field := range c.idFields {
+		value, ok := record[field]
+		if !ok || value == nil {
+			return ""
+		}
+		parts[i] = fmt.Sprintf("%v", value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// IDValue returns the value a foreign key referring to record holds: the
+// value of its id field, or the joined id for a composite key.
+//
+// Parameters:
+//   - record: The record
+//
+// Returns:
+//   - interface{}: The id value, or nil if the record has no id
+func (c *Collection) IDValue(record map[string]interface{}) interface{} {
+	if len(c.idFields) == 1 {
+		return record[c.idFields[0]]
+	}
+	if id := c.RecordID(record); id != "" {
+		return id
+	}
+	return nil
+}
+
+// toValues converts records to the []interface{} form used in decoded JSON.
+func toValues(records []map[string]interface{}) []interface{} {
+	values := make([]interface{}, len(records))
+	for i, record := range records {
+		values[i] = record
+	}
+	return values
+}
+
+// decode parses the content of the collection's data file in its format. For
+// CSV and TSV files it also returns the header row.
+func (c *Collection) decode(content []byte) (interface{}, []string, error) {
+	switch c.format {
+	case files.FormatYAML:
+		doc, err := decodeYAML(content)
+		return doc, nil, err
+	case files.FormatCSV, files.FormatTSV:
+		return decodeCSV(content, c.comma())
+	case files.FormatNDJSON:
+		records, err := decodeNDJSON(content)
+		return records, nil, err
+	}
+	var doc interface{}
+	err := DecodeJSON(content, &doc)
+	return doc, nil, err
+}
+
+// encode writes a document in the format of the collection's data file. For
+// CSV and TSV files it also returns the header row that was written. The
+// documents of CSV, TSV and NDJSON files are always arrays of records.
+func (c *Collection) encode(doc interface{}) ([]byte, []string, error) {
+	switch c.format {
+	case files.FormatYAML:
+		content, err := encodeYAML(doc)
+		return content, nil, err
+	case files.FormatCSV, files.FormatTSV:
+		return encodeCSV(doc.([]interface{}), c.columns, c.comma())
+	case files.FormatNDJSON:
+		content, err := encodeNDJSON(doc.([]interface{}))
+		return content, nil, err
+	}
+	content, err := EncodeJSON(doc)
+	return content, nil, err
+}
+
+// Columns returns the header row of a CSV or TSV data file, in file order, or
+// nil for files in other formats. The returned slice must not be modified.
+func (c *Collection) Columns() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.columns
+}
+
+// Encode writes a value as it would be saved to a data file of the given
+// format. CSV, TSV and NDJSON only hold arrays of records.
+//
+// Parameters:
+//   - format: The format, such as files.FormatCSV
+//   - v: The decoded JSON value to write
+//   - columns: For CSV and TSV, the columns to write first, in order, or nil
+//     to sort all columns
+//
+// Returns:
+//   - []byte: The encoded content
+//   - error: An error if v can't be written in the format
+func Encode(format string, v interface{}, columns []string) ([]byte, error) {
+	switch format {
+	case files.FormatJSON:
+		return EncodeJSON(v)
+	case files.FormatYAML:
+		return encodeYAML(v)
+	case files.FormatCSV, files.FormatTSV, files.FormatNDJSON:
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	records, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s can only hold an array of records", strings.ToUpper(format))
+	}
+	if format == files.FormatNDJSON {
+		return encodeNDJSON(records)
+	}
+	comma := ','
+	if format == files.FormatTSV {
+		comma = '\t'
+	}
+	content, _, err := encodeCSV(records, columns, comma)
+	return content, err
+}
+
+// comma returns the field delimiter of a CSV or TSV data file.
+func (c *Collection) comma() rune {
+	if c.format == files.FormatTSV {
+		return '\t'
+	}
+	return ','
+}
+
+// DecodeJSON unmarshals JSON content into v, keeping numbers as json.Number so
+// that values are written back to disk exactly as they were read. Request
+// bodies are decoded with it too, so records are stored the same way.
+func DecodeJSON(content []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after top-level JSON value")
+	}
+	return nil
+}
+
+// EncodeJSON marshals v as indented JSON without escaping HTML characters,
+// so URLs containing '&' stay readable in the data files and responses.
+func EncodeJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/RAshkettle/getter/internal/query"
+)
+
+// decodeCSV parses a CSV or TSV file into records. The header row names the
+// fields and a dotted header such as "address.city" becomes a field of a
+// nested object. Cell types are inferred: valid JSON numbers become
+// json.Number, "true" and "false" (in any case) booleans, empty cells null,
+// and cells holding a JSON array or object that value; anything else is a
+// string. Cells missing at the end of a short row are left out of the record.
+//
+// Parameters:
+//   - content: The file content
+//   - comma: The field delimiter, ',' for CSV or '\t' for TSV
+//
+// Returns:
+//   - []interface{}: The records, as map[string]interface{} values
+//   - []string: The header row, in file order
+//   - error: An error if the file can't be parsed or the headers conflict
+func decodeCSV(content []byte, comma rune) ([]interface{}, []string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\ufeff"))))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = comma == '\t'
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		return []interface{}{}, nil, nil
+	}
+
+	columns := rows[0]
+	paths := make([][]string, len(columns))
+	seen := make(map[string]bool, len(columns))
+	for i, column := range columns {
+		if !query.ValidPath(column) {
+			return nil, nil, fmt.Errorf("invalid column name %q", column)
+		}
+		if seen[column] {
+			return nil, nil, fmt.Errorf("duplicate column %q", column)
+		}
+		seen[column] = true
+		paths[i] = strings.Split(column, ".")
+	}
+
+	records := make([]interface{}, 0, len(rows)-1)
+	for line, row := range rows[1:] {
+		if len(row) > len(columns) {
+			return nil, nil, fmt.Errorf("row %d has %d fields, expected %d", line+2, len(row), len(columns))
+		}
+		record := make(map[string]interface{}, len(row))
+		for i, cell := range row {
+			if err := setNested(record, paths[i], cellValue(cell)); err != nil {
+				return nil, nil, fmt.Errorf("row %d: %w", line+2, err)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, columns, nil
+}
+
+// cellValue infers the value of a CSV cell, as described for decodeCSV.
+func cellValue(cell string) interface{} {
+	switch {
+	case cell == "":
+		return nil
+	case strings.EqualFold(cell, "true"):
+		return true
+	case strings.EqualFold(cell, "false"):
+		return false
+	}
+
+	switch cell[0] {
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		if json.Valid([]byte(cell)) {
+			return json.Number(cell)
+		}
+	case '[', '{':
+		var value interface{}
+		if err := DecodeJSON([]byte(cell), &value); err == nil {
+			return value
+		}
+	}
+	return cell
+}
+
+// setNested sets the value at a path of keys in a record, creating the
+// objects along the way. Empty cells give way to values of other columns, so
+// the columns "address" and "address.city" can both exist as long as only
+// one of them is filled in a row.
+func setNested(record map[string]interface{}, path []string, value interface{}) error {
+	for _, key := range path[:len(path)-1] {
+		next := record[key]
+		if next == nil {
+			next = make(map[string]interface{})
+			record[key] = next
+		}
+		object, ok := next.(map[string]interface{})
+		if !ok {
+			if value == nil {
+				return nil
+			}
+			return fmt.Errorf("column %s conflicts with column %s", strings.Join(path, "."), key)
+		}
+		record = object
+	}
+
+	last := path[len(path)-1]
+	if existing, ok := record[last]; ok && existing != nil {
+		if value == nil {
+			return nil
+		}
+		return fmt.Errorf("column %s conflicts with another column", strings.Join(path, "."))
+	}
+	record[last] = value
+	return nil
+}
+
+// encodeCSV writes records as CSV or TSV. Nested objects are flattened into
+// dotted columns. The given columns come first, in their order, so a file
+// keeps its layout; columns for fields that aren't among them are added
+// after them in sorted order. Arrays are written as JSON and null as an
+// empty cell.
+//
+// Parameters:
+//   - records: The records, as map[string]interface{} values
+//   - columns: The columns of the file when it was read, or nil
+//   - comma: The field delimiter, ',' for CSV or '\t' for TSV
+//
+// Returns:
+//   - []byte: The file content
+//   - []string: The header row that was written
+//   - error: An error if a record is not an object or a value can't be written
+func encodeCSV(records []interface{}, columns []string, comma rune) ([]byte, []string, error) {
+	flat := make([]map[string]string, len(records))
+	known := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		known[column] = true
+	}
+
+	var added []string
+	for i, value := range records {
+		record, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("record %d is not an object", i)
+		}
+		flat[i] = make(map[string]string, len(record))
+		if err := flatten(flat[i], "", record); err != nil {
+			return nil, nil, err
+		}
+		for column := range flat[i] {
+			if !known[column] {
+				known[column] = true
+				added = append(added, column)
+			}
+		}
+	}
+	sort.Strings(added)
+	columns = append(columns[:len(columns):len(columns)], added...)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = comma
+	writer.Write(columns)
+	row := make([]string, len(columns))
+	for _, record := range flat {
+		for i, column := range columns {
+			row[i] = record[column]
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), columns, nil
+}
+
+// flatten adds the cells of an object to flat, keyed by dotted path.
+func flatten(flat map[string]string, prefix string, object map[string]interface{}) error {
+	for key, value := range object {
+		path := prefix + key
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			if err := flatten(flat, path+".", nested); err != nil {
+				return err
+			}
+			continue
+		}
+
+		cell, err := cellString(value)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", path, err)
+		}
+		flat[path] = cell
+	}
+	return nil
+}
+
+// cellString formats a value for a CSV cell, the reverse of cellValue.
+func cellString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, json.Number, float64, int:
+		return fmt.Sprint(v), nil
+	}
+
+	content, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestDecodeCSV tests that CSV and TSV rows decode to typed, nested records
+func TestDecodeCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		comma    rune
+		expected []interface{}
+		columns  []string
+		wantErr  bool
+	}{
+		{
+			name:     "Inferred types",
+			content:  "id,price,big,active,sold,note,name,zip\n1,12.50,-1e3,TRUE,false,,Lamp,007\n",
+			comma:    ',',
+			expected: []interface{}{map[string]interface{}{"id": json.Number("1"), "price": json.Number("12.50"), "big": json.Number("-1e3"), "active": true, "sold": false, "note": nil, "name": "Lamp", "zip": "007"}},
+			columns:  []string{"id", "price", "big", "active", "sold", "note", "name", "zip"},
+		},
+		{
+			name:     "Dotted headers",
+			content:  "id,address.city,address.geo.lat\n1,Portland,45.5\n",
+			comma:    ',',
+			expected: []interface{}{map[string]interface{}{"id": json.Number("1"), "address": map[string]interface{}{"city": "Portland", "geo": map[string]interface{}{"lat": json.Number("45.5")}}}},
+			columns:  []string{"id", "address.city", "address.geo.lat"},
+		},
+		{
+			name:     "JSON cells and quoting",
+			content:  "id,tags,title\n1,\"[\"\"a\"\",\"\"b\"\"]\",\"Desk, oak\"\n2,[not json,{}\n",
+			comma:    ',',
+			expected: []interface{}{map[string]interface{}{"id": json.Number("1"), "tags": []interface{}{"a", "b"}, "title": "Desk, oak"}, map[string]interface{}{"id": json.Number("2"), "tags": "[not json", "title": map[string]interface{}{}}},
+			columns:  []string{"id", "tags", "title"},
+		},
+		{
+			name:     "TSV with short row",
+			content:  "\ufeffid\tname\tnote\n1\tLamp \"tall\"\n",
+			comma:    '\t',
+			expected: []interface{}{map[string]interface{}{"id": json.Number("1"), "name": "Lamp \"tall\""}},
+			columns:  []string{"id", "name", "note"},
+		},
+		{
+			name:     "Empty cell next to nested column",
+			content:  "id,address,address.city\n1,,Portland\n2,unknown,\n",
+			comma:    ',',
+			expected: []interface{}{map[string]interface{}{"id": json.Number("1"), "address": map[string]interface{}{"city": "Portland"}}, map[string]interface{}{"id": json.Number("2"), "address": "unknown"}},
+			columns:  []string{"id", "address", "address.city"},
+		},
+		{name: "Empty file", content: "", comma: ',', expected: []interface{}{}},
+		{name: "Duplicate column", content: "id,id\n1,2\n", comma: ',', wantErr: true},
+		{name: "Empty column name", content: "id,\n1,2\n", comma: ',', wantErr: true},
+		{name: "Invalid dotted column", content: "id,address.\n1,2\n", comma: ',', wantErr: true},
+		{name: "Long row", content: "id\n1,2\n", comma: ',', wantErr: true},
+		{name: "Conflicting columns", content: "address,address.city\nMain St,Portland\n", comma: ',', wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, columns, err := decodeCSV([]byte(tt.content), tt.comma)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(records, tt.expected) {
+				t.Errorf("Expected %#v, got %#v", tt.expected, records)
+			}
+			if !reflect.DeepEqual(columns, tt.columns) {
+				t.Errorf("Expected columns %v, got %v", tt.columns, columns)
+			}
+		})
+	}
+}
+
+// TestEncodeCSV tests that records are written with the original columns
+// first and read back as the same values
+func TestEncodeCSV(t *testing.T) {
+	records := []interface{}{
+		map[string]interface{}{"sku": "A-1", "id": json.Number("1"), "price": json.Number("12.50"), "address": map[string]interface{}{"city": "Portland"}},
+		map[string]interface{}{"id": json.Number("2"), "tags": []interface{}{"a", "b"}, "active": true, "note": "Desk, oak"},
+	}
+
+	content, columns, err := encodeCSV(records, []string{"price", "id", "sku"}, ',')
+	if err != nil {
+		t.Fatalf("encodeCSV() error = %v", err)
+	}
+	expected := "price,id,sku,active,address.city,note,tags\n" +
+		"12.50,1,A-1,,Portland,,\n" +
+		",2,,true,,\"Desk, oak\",\"[\"\"a\"\",\"\"b\"\"]\"\n"
+	if string(content) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, content)
+	}
+	if !reflect.DeepEqual(columns, []string{"price", "id", "sku", "active", "address.city", "note", "tags"}) {
+		t.Errorf("Unexpected columns %v", columns)
+	}
+
+	decoded, _, err := decodeCSV(content, ',')
+	if err != nil {
+		t.Fatalf("decodeCSV() error = %v", err)
+	}
+	// Fields a record doesn't have come back as null
+	expectedRecords := []interface{}{
+		map[string]interface{}{"sku": "A-1", "id": json.Number("1"), "price": json.Number("12.50"), "address": map[string]interface{}{"city": "Portland"}, "active": nil, "note": nil, "tags": nil},
+		map[string]interface{}{"sku": nil, "id": json.Number("2"), "price": nil, "address": map[string]interface{}{"city": nil}, "tags": []interface{}{"a", "b"}, "active": true, "note": "Desk, oak"},
+	}
+	if !reflect.DeepEqual(decoded, expectedRecords) {
+		t.Errorf("Expected %v, got %v", expectedRecords, decoded)
+	}
+
+	if _, _, err := encodeCSV([]interface{}{json.Number("1")}, nil, ','); err == nil {
+		t.Error("Expected an error for a record that is not an object")
+	}
+}
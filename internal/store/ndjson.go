@@ -0,0 +1,225 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/RAshkettle/getter/internal/ids"
+)
+
+// scanNDJSON reads newline-delimited JSON, one record per line, and calls fn
+// for each record in turn. Only one line is held in memory at a time, so
+// files of any size can be read. Blank lines are skipped, and so is a final
+// line without a newline that isn't valid JSON: that is what an append cut
+// short by a crash leaves behind, and appendLocked replaces it.
+//
+// Parameters:
+//   - r: The reader to read lines from
+//   - fn: Called with each record; an error stops the scan and is returned
+//
+// Returns:
+//   - error: An error if a line is not a JSON object, or the error returned by fn
+func scanNDJSON(r io.Reader, fn func(record map[string]interface{}) error) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		content, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 {
+			var record map[string]interface{}
+			if decodeErr := DecodeJSON(trimmed, &record); decodeErr != nil || record == nil {
+				if err == io.EOF && decodeErr != nil {
+					return nil
+				}
+				return fmt.Errorf("line %d is not a JSON object", line)
+			}
+			if fnErr := fn(record); fnErr != nil {
+				return fnErr
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// streamFile calls fn for each record of an NDJSON file, as scanNDJSON. Only
+// the lines present when the file is opened are read, so records appended
+// meanwhile are left for the next reader.
+func streamFile(path string, fn func(record map[string]interface{}) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return scanNDJSON(io.LimitReader(f, info.Size()), fn)
+}
+
+// decodeNDJSON parses a whole NDJSON file into records.
+func decodeNDJSON(content []byte) ([]interface{}, error) {
+	records := []interface{}{}
+	err := scanNDJSON(bytes.NewReader(content), func(record map[string]interface{}) error {
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+// encodeNDJSON writes records as NDJSON, each on a single line.
+func encodeNDJSON(records []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, record := range records {
+		line, err := ndjsonLine(record)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+	}
+	return buf.Bytes(), nil
+}
+
+// ndjsonLine encodes a record as a line of NDJSON, ending with a newline.
+// HTML characters are not escaped, as in other data files.
+func ndjsonLine(record interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(record); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// appendLocked adds a record to the end of the collection's NDJSON file
+// without rewriting it, and syncs the file before returning. The line is
+// written in a single call, so a crash can at worst leave part of it, which
+// readers skip and the next append replaces. The caller must hold c.mu and
+// the directory lock.
+func (c *Collection) appendLocked(record map[string]interface{}) error {
+	line, err := ndjsonLine(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(c.path, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if err := appendLine(f, line); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+	c.modTime = info.ModTime()
+	c.size = info.Size()
+	return nil
+}
+
+// appendLine writes a line at the end of an NDJSON file and syncs it. If the
+// file doesn't end with a newline, its last line is either a complete record,
+// which the new line is separated from, or the remains of an interrupted
+// append, which are cut off first.
+func appendLine(f *os.File, line []byte) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	start, err := lastLineStart(f, info.Size())
+	if err != nil {
+		return err
+	}
+	if start < info.Size() {
+		last := make([]byte, info.Size()-start)
+		if _, err := f.ReadAt(last, start); err != nil {
+			return err
+		}
+		var record map[string]interface{}
+		if trimmed := bytes.TrimSpace(last); len(trimmed) == 0 || DecodeJSON(trimmed, &record) != nil {
+			if err := f.Truncate(start); err != nil {
+				return err
+			}
+		} else {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+
+	if _, err := f.Write(line); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// lastLineStart returns the offset just after the last newline in the first
+// size bytes of f, or 0 if there is none. The file is read backwards in
+// blocks, so only the last line is read.
+func lastLineStart(f *os.File, size int64) (int64, error) {
+	block := make([]byte, 4096)
+	for end := size; end > 0; {
+		n := min(int64(len(block)), end)
+		if _, err := f.ReadAt(block[:n], end-n); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(block[:n], '\n'); i >= 0 {
+			return end - n + int64(i) + 1, nil
+		}
+		end -= n
+	}
+	return 0, nil
+}
+
+// appendUnloaded adds a record to an NDJSON collection that is not held in
+// memory. The file is scanned for the ids in use, which are all that is kept
+// in memory, and the record is appended as a new line.
+func (c *Collection) appendUnloaded(record map[string]interface{}, generator ids.Generator) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return withDirLock(c.dir, func() error {
+		var existing []interface{}
+		taken := make(map[string]bool)
+		err := streamFile(c.path, func(r map[string]interface{}) error {
+			if id := c.RecordID(r); id != "" {
+				taken[id] = true
+				if len(c.idFields) == 1 {
+					existing = append(existing, r[c.idFields[0]])
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%w: %s", ErrNotFound, c.name)
+			}
+			return fmt.Errorf("invalid NDJSON in file %s: %w", c.path, err)
+		}
+
+		id, err := c.assignID(record, generator, func() []interface{} { return existing })
+		if err != nil {
+			return err
+		}
+		if taken[id] {
+			return ErrDuplicateID
+		}
+		return c.appendLocked(record)
+	})
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestDecodeNDJSON tests that each line of an NDJSON file becomes a record
+func TestDecodeNDJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "Records",
+			content:  "{\"id\": 1, \"type\": \"click\"}\n{\"id\": 2, \"price\": 12.50}\n",
+			expected: []interface{}{map[string]interface{}{"id": json.Number("1"), "type": "click"}, map[string]interface{}{"id": json.Number("2"), "price": json.Number("12.50")}},
+		},
+		{
+			name:     "Blank lines, CRLF and no final newline",
+			content:  "{\"id\": 1}\r\n\n  \n{\"id\": 2}",
+			expected: []interface{}{map[string]interface{}{"id": json.Number("1")}, map[string]interface{}{"id": json.Number("2")}},
+		},
+		{name: "Empty file", content: "", expected: []interface{}{}},
+		{name: "Torn final line", content: "{\"id\": 1}\n{\"id\": 2, \"ty", expected: []interface{}{map[string]interface{}{"id": json.Number("1")}}},
+		{name: "Invalid line with a newline", content: "{\"id\": 1}\n{\"id\": 2, \"ty\n", wantErr: true},
+		{name: "Final line not an object", content: "{\"id\": 1}\nnull", wantErr: true},
+		{name: "Not an object", content: "{\"id\": 1}\n[1]\n", wantErr: true},
+		{name: "Two values on a line", content: "{\"id\": 1} {\"id\": 2}\n", wantErr: true},
+		{name: "Invalid JSON", content: "{\"id\": 1\n}\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeNDJSON([]byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeNDJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %#v, got %#v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestEncodeNDJSON tests that records are written one per line
+func TestEncodeNDJSON(t *testing.T) {
+	records := []interface{}{
+		map[string]interface{}{"id": json.Number("1"), "note": "<b>", "tags": []interface{}{"a"}},
+		map[string]interface{}{"id": json.Number("2"), "address": map[string]interface{}{"city": "Portland"}},
+	}
+
+	content, err := encodeNDJSON(records)
+	if err != nil {
+		t.Fatalf("encodeNDJSON() error = %v", err)
+	}
+	expected := "{\"id\":1,\"note\":\"<b>\",\"tags\":[\"a\"]}\n{\"address\":{\"city\":\"Portland\"},\"id\":2}\n"
+	if string(content) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, content)
+	}
+
+	decoded, err := decodeNDJSON(content)
+	if err != nil {
+		t.Fatalf("decodeNDJSON() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, records) {
+		t.Errorf("Expected %v to round-trip, got %v", records, decoded)
+	}
+}
@@ -0,0 +1,518 @@
+// Package store keeps the collections of a data directory in memory.
+// Each collection is parsed from its file once, indexed by id and guarded by
+// its own lock; changes are written back to the file atomically.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/RAshkettle/getter/internal/files"
+	"github.com/RAshkettle/getter/internal/ids"
+)
+
+var (
+	// ErrNotFound is returned when a collection has no data file.
+	ErrNotFound = errors.New("collection not found")
+
+	// ErrRecordNotFound is returned when no record has the requested id.
+	ErrRecordNotFound = errors.New("record not found")
+
+	// ErrDuplicateID is returned when a new record uses an id that is already taken.
+	ErrDuplicateID = errors.New("record id already exists")
+
+	// ErrMissingID is returned when a new record lacks a field of a composite
+	// key; such ids can't be generated.
+	ErrMissingID = errors.New("record is missing a field of its id")
+
+	// ErrSingleton is returned when a record operation is used on a file
+	// holding a single object rather than an array of records.
+	ErrSingleton = errors.New("resource is a single object, not a collection")
+)
+
+// Store holds the collections of a data directory. Collections are loaded
+// lazily on first use and kept in memory afterwards. Files are parsed outside
+// the store's lock, so loading one collection doesn't hold up the others.
+type Store struct {
+	dir string
+
+	mu          sync.Mutex
+	collections map[string]*Collection
+
+	// idFields holds the id fields set for each collection or file; the ""
+	// key holds the default for all collections.
+	idFields map[string][]string
+}
+
+// DefaultIDField is the field that identifies records unless another is set
+// with SetIDFields.
+const DefaultIDField = "id"
+
+// New creates a Store for the data files in dir.
+//
+// Parameters:
+//   - dir: The data directory holding the collection files
+//
+// Returns:
+//   - *Store: The new, empty store
+func New(dir string) *Store {
+	return &Store{
+		dir:         dir,
+		collections: make(map[string]*Collection),
+		idFields:    make(map[string][]string),
+	}
+}
+
+// SetIDFields sets the fields that identify the records of a collection. A
+// single field replaces "id", e.g. "sku"; several fields form a composite key
+// whose values are joined with commas in record URLs. The setting applies to
+// collections loaded afterwards.
+//
+// Parameters:
+//   - name: The collection name, e.g. "products" or "store/products"; a file
+//     name covers every collection of the file and "" sets the default
+//   - fields: The id fields, in the order they appear in ids
+//
+// Returns:
+//   - error: An error if no fields are given or a field is empty
+func (s *Store) SetIDFields(name string, fields []string) error {
+	if len(fields) == 0 || slices.Contains(fields, "") {
+		return fmt.Errorf("invalid id fields %q for %q", strings.Join(fields, ","), name)
+	}
+
+	if name != "" {
+		file, key, err := parseName(name)
+		if err != nil {
+			return err
+		}
+		name = file
+		if key != "" {
+			name = file + "/" + key
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idFields[name] = slices.Clone(fields)
+	return nil
+}
+
+// idFieldsFor returns the id fields of a collection: those set for the
+// collection, its file or all collections, in that order, or DefaultIDField.
+func (s *Store) idFieldsFor(name, file string) []string {
+	for _, key := range []string{name, file, ""} {
+		if fields, ok := s.idFields[key]; ok {
+			return fields
+		}
+	}
+	return []string{DefaultIDField}
+}
+
+// Dir returns the data directory of the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Collection returns the named collection, loading it from its data file on
+// first use. The name may be given with or without the file's extension. The
+// data file is <name>.json, <name>.yaml, <name>.yml, <name>.csv, <name>.tsv,
+// <name>.ndjson or <name>.jsonl; if several exist, the first in that order is
+// used.
+//
+// A name of the form "<file>/<key>", such as "store/products", refers to the
+// array under key in a file holding several arrays. A plain file name refers
+// to the file's records: the whole file if it is a top-level array, otherwise
+// the array chosen as described for Collection.
+//
+// Parameters:
+//   - name: The collection name, e.g. "customers" or "store/products"
+//
+// Returns:
+//   - *Collection: The collection
+//   - error: ErrNotFound if there is no data file or array for the name, or an error if the file is invalid
+func (s *Store) Collection(name string) (*Collection, error) {
+	file, key, err := parseName(name)
+	if err != nil {
+		return nil, err
+	}
+	name = file
+	if key != "" {
+		name = file + "/" + key
+	}
+
+	s.mu.Lock()
+	c, ok := s.collections[name]
+	if !ok {
+		path, found := s.findFile(file)
+		if !found {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		// The collection is registered before it is loaded, so concurrent
+		// callers wait for the same load while other collections stay
+		// available
+		c = s.newCollection(name, file, key, path)
+		s.collections[name] = c
+	}
+	s.mu.Unlock()
+
+	c.loadOnce.Do(func() { c.loadErr = c.load() })
+	if c.loadErr != nil {
+		s.forget(c)
+		return nil, c.loadErr
+	}
+	return c, nil
+}
+
+// newCollection creates a collection that has not been loaded yet. The
+// caller must hold s.mu.
+func (s *Store) newCollection(name, file, key, path string) *Collection {
+	return &Collection{
+		name:     name,
+		file:     file,
+		fixedKey: key,
+		idFields: s.idFieldsFor(name, file),
+		path:     path,
+		format:   files.FileFormat(path),
+		dir:      s.dir,
+		store:    s,
+	}
+}
+
+// Format returns the format of the named collection's data file, such as
+// files.FormatNDJSON, without loading the collection.
+//
+// Parameters:
+//   - name: The collection name
+//
+// Returns:
+//   - string: The format of the data file
+//   - error: ErrNotFound if there is no data file for the name
+func (s *Store) Format(name string) (string, error) {
+	file, _, err := parseName(name)
+	if err != nil {
+		return "", err
+	}
+	path, ok := s.findFile(file)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return files.FileFormat(path), nil
+}
+
+// Stream calls fn for each record of an NDJSON collection, reading its file
+// line by line instead of loading the collection, so memory use doesn't grow
+// with the size of the file. Records are read from disk even if the
+// collection is loaded; changes are written to disk as they are made, so both
+// agree.
+//
+// Parameters:
+//   - name: The collection name
+//   - fn: Called with each record in file order; an error stops the stream
+//     and is returned. The record may be kept or modified.
+//
+// Returns:
+//   - error: ErrNotFound if there is no NDJSON file for the name, an error if
+//     a line is not a JSON object, or the error returned by fn
+func (s *Store) Stream(name string, fn func(record map[string]interface{}) error) error {
+	file, key, err := parseName(name)
+	if err != nil {
+		return err
+	}
+	path, ok := s.findFile(file)
+	if !ok || key != "" || files.FileFormat(path) != files.FormatNDJSON {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	err = streamFile(path, fn)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return err
+}
+
+// Append adds a record to a collection. A loaded collection gets it through
+// Insert. An NDJSON collection that isn't loaded stays so: its file is
+// scanned for the ids in use and the record is appended as a new line.
+//
+// Parameters:
+//   - name: The collection name
+//   - record: The new record; it is stored as is and must not be modified
+//     afterwards. A generated id is set in it.
+//   - generator: Returns the generator for missing ids of the named collection
+//
+// Returns:
+//   - *Collection: The collection, which is not loaded if the record was
+//     appended to an NDJSON file directly; use it only for its name and
+//     RecordID in that case
+//   - error: As for Insert
+func (s *Store) Append(name string, record map[string]interface{}, generator func(name string) ids.Generator) (*Collection, error) {
+	file, key, err := parseName(name)
+	if err != nil {
+		return nil, err
+	}
+	name = file
+	if key != "" {
+		name = file + "/" + key
+	}
+
+	s.mu.Lock()
+	c, loaded := s.collections[name]
+	path, found := s.findFile(file)
+	direct := !loaded && found && key == "" && files.FileFormat(path) == files.FormatNDJSON
+	if direct {
+		c = s.newCollection(name, file, key, path)
+	}
+	s.mu.Unlock()
+
+	if !direct {
+		if c, err = s.Collection(name); err != nil {
+			return nil, err
+		}
+		if _, err := c.Insert(record, generator(c.name)); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	if err := c.appendUnloaded(record, generator(c.name)); err != nil {
+		return nil, err
+	}
+	// Collections loaded meanwhile pick up the new line
+	s.Refresh(file)
+	return c, nil
+}
+
+// findFile returns the path of the data file with the given base name. Its
+// extension may be in any case, as for files.FileFormat; if several files
+// match, the one whose extension comes first in files.DataExtensions wins.
+func (s *Store) findFile(file string) (string, bool) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return "", false
+	}
+
+	best, found := len(files.DataExtensions), ""
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if strings.TrimSuffix(name, ext) != file {
+			continue
+		}
+		rank := slices.Index(files.DataExtensions, strings.ToLower(ext))
+		if rank < 0 || rank >= best {
+			continue
+		}
+		// Stat follows symbolic links, which may point to data files
+		path := filepath.Join(s.dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			best, found = rank, path
+		}
+	}
+	return found, found != ""
+}
+
+// fileCollections returns the loaded collections backed by the named data file.
+func (s *Store) fileCollections(file string) []*Collection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var collections []*Collection
+	for _, c := range s.collections {
+		if c.file == file {
+			collections = append(collections, c)
+		}
+	}
+	return collections
+}
+
+// Remove deletes the named collection and drops every collection backed by
+// its data file from memory. A collection named "<file>/<key>" only loses its
+// array: the key is removed from the file and the other arrays are kept.
+// Otherwise the data file itself is deleted.
+//
+// Parameters:
+//   - name: The collection name
+//
+// Returns:
+//   - error: ErrNotFound if there is no such collection, or an error if the file can't be written or removed
+func (s *Store) Remove(name string) error {
+	c, err := s.Collection(name)
+	if err != nil {
+		return err
+	}
+
+	if c.fixedKey != "" {
+		err = c.removeKey()
+	} else {
+		c.mu.Lock()
+		err = withDirLock(s.dir, func() error {
+			return os.Remove(c.path)
+		})
+		c.mu.Unlock()
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	s.Forget(c.file)
+	return nil
+}
+
+// Refresh reloads the collections backed by the named data file if the file
+// changed since they were loaded or last written by the store. Collections
+// that haven't been loaded yet are left alone; they are read on first use. If
+// the file can't be parsed, for example because an editor is still writing
+// it, the previous version stays in memory and the error is returned.
+//
+// Parameters:
+//   - name: The name of the data file, without extension
+//
+// Returns:
+//   - bool: True if any collection was reloaded
+//   - error: An error if the changed file could not be loaded
+func (s *Store) Refresh(name string) (bool, error) {
+	file, _, err := parseName(name)
+	if err != nil {
+		return false, err
+	}
+
+	var reloaded bool
+	var errs []error
+	for _, c := range s.fileCollections(file) {
+		ok, err := s.refresh(c)
+		reloaded = reloaded || ok
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return reloaded, errors.Join(errs...)
+}
+
+// refresh reloads a single collection if its data file changed. A collection
+// whose file or array is gone is forgotten.
+func (s *Store) refresh(c *Collection) (bool, error) {
+	info, err := os.Stat(c.path)
+	if os.IsNotExist(err) {
+		s.forget(c)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return false, nil
+	}
+
+	// Load into a copy so a broken file leaves the current version intact
+	fresh := &Collection{name: c.name, file: c.file, fixedKey: c.fixedKey, idFields: c.idFields, path: c.path, format: c.format, dir: c.dir}
+	if err := fresh.loadLocked(); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			s.forget(c)
+			return true, nil
+		}
+		return false, err
+	}
+	c.data, c.key, c.singleton, c.columns = fresh.data, fresh.key, fresh.singleton, fresh.columns
+	c.records, c.index, c.text = fresh.records, fresh.index, fresh.text
+	c.modTime, c.size = fresh.modTime, fresh.size
+	return true, nil
+}
+
+// syncSiblings refreshes the other collections backed by the same data file
+// as c after c has written it, so they see its changes.
+func (s *Store) syncSiblings(c *Collection) {
+	for _, sibling := range s.fileCollections(c.file) {
+		if sibling != c {
+			s.refresh(sibling)
+		}
+	}
+}
+
+// forget drops a single collection from memory.
+func (s *Store) forget(c *Collection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.collections[c.name] == c {
+		delete(s.collections, c.name)
+	}
+}
+
+// Loaded reports whether any collection backed by the named data file is
+// currently held in memory.
+//
+// Parameters:
+//   - name: The name of the data file, without extension
+//
+// Returns:
+//   - bool: True if a collection of the file has been loaded
+func (s *Store) Loaded(name string) bool {
+	file, _, err := parseName(name)
+	if err != nil {
+		return false
+	}
+	return len(s.fileCollections(file)) > 0
+}
+
+// Forget drops the collections backed by the named data file from memory, so
+// they are loaded from the file again on next use.
+//
+// Parameters:
+//   - name: The name of the data file, without extension
+func (s *Store) Forget(name string) {
+	file, _, err := parseName(name)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, c := range s.collections {
+		if c.file == file {
+			delete(s.collections, key)
+		}
+	}
+}
+
+// CollectionName returns the name of the collection backed by the data file
+// with the given file name, or false if the file does not hold a collection.
+//
+// Parameters:
+//   - filename: The file name, without directory
+//
+// Returns:
+//   - string: The collection name
+//   - bool: True if the file holds a collection
+func CollectionName(filename string) (string, bool) {
+	if files.FileFormat(filename) == "" {
+		return "", false
+	}
+	file, _, err := parseName(filename)
+	if err != nil {
+		return "", false
+	}
+	return file, true
+}
+
+// parseName splits a collection name into the name of its data file, without
+// its extension, and the key of its array, which is empty unless the
+// name has the form "<file>/<key>". Names that could refer to files outside
+// the data directory are rejected.
+func parseName(name string) (file, key string, err error) {
+	file, key, hasKey := strings.Cut(name, "/")
+	file = files.TrimDataExtension(file)
+	if file == "" || strings.HasPrefix(file, ".") || strings.Contains(file, `\`) ||
+		hasKey && (key == "" || strings.ContainsAny(key, `/\`)) {
+		return "", "", fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	return file, key, nil
+}
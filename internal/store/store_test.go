@@ -0,0 +1,950 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RAshkettle/getter/internal/files"
+	"github.com/RAshkettle/getter/internal/ids"
+	"github.com/RAshkettle/getter/internal/query"
+)
+
+// testProducts is the content of the products.json file used by the store tests
+const testProducts = `{
+  "products": [
+    {"id": 1, "title": "Ultra Slim Laptop Pro", "price": 1299.99},
+    {"id": 2, "title": "Artisan Coffee Maker", "price": 149.95},
+    {"id": 3, "title": "SmartLife Fitness Watch", "price": 89.99}
+  ]
+}`
+
+// newTestStore creates a store over a temporary directory holding the given files
+func newTestStore(t testing.TB, dataFiles map[string]string) *Store {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	for name, content := range dataFiles {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write test file %s: %v", name, err)
+		}
+	}
+	return New(tempDir)
+}
+
+// TestCollection tests loading collections and looking up records by id
+func TestCollection(t *testing.T) {
+	s := newTestStore(t, map[string]string{
+		"products.json": testProducts,
+		"count.json":    `42`,
+		"broken.json":   `{"products": [`,
+	})
+
+	tests := []struct {
+		name        string
+		collection  string
+		errNotFound bool
+		wantErr     bool
+	}{
+		{name: "Existing collection", collection: "products"},
+		{name: "Name with extension", collection: "products.json"},
+		{name: "Missing file", collection: "orders", errNotFound: true, wantErr: true},
+		{name: "Path outside the data directory", collection: "../products", errNotFound: true, wantErr: true},
+		{name: "Hidden file", collection: ".products", errNotFound: true, wantErr: true},
+		{name: "No array of records", collection: "count", wantErr: true},
+		{name: "Invalid JSON", collection: "broken", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := s.Collection(tt.collection)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Collection(%q) error = %v, wantErr %v", tt.collection, err, tt.wantErr)
+			}
+			if errors.Is(err, ErrNotFound) != tt.errNotFound {
+				t.Errorf("Expected ErrNotFound: %v, got %v", tt.errNotFound, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if c.Name() != "products" || c.Key() != "products" || c.Len() != 3 {
+				t.Errorf("Unexpected collection %s/%s with %d records", c.Name(), c.Key(), c.Len())
+			}
+
+			record, ok := c.Get("2")
+			if !ok || record["title"] != "Artisan Coffee Maker" {
+				t.Errorf("Get(2) = %v, %v", record, ok)
+			}
+			if _, ok := c.Get("9"); ok {
+				t.Error("Expected Get(9) to find nothing")
+			}
+		})
+	}
+
+	// Collections are only loaded once
+	first, _ := s.Collection("products")
+	second, _ := s.Collection("products.json")
+	if first != second {
+		t.Error("Expected the same collection to be returned for repeated lookups")
+	}
+}
+
+// TestCollectionLayouts tests files holding a top-level array and files
+// holding several arrays
+func TestCollectionLayouts(t *testing.T) {
+	s := newTestStore(t, map[string]string{
+		"events.json": `[{"id": 1, "type": "click"}, {"id": 2, "type": "view"}]`,
+		"store.json":  `{"products": [{"id": 1}, {"id": 2}], "categories": [{"id": "c1"}], "meta": {"version": 1}}`,
+	})
+
+	tests := []struct {
+		collection string
+		key        string
+		count      int
+		document   string
+	}{
+		{collection: "events", key: "", count: 2, document: `[{"id":1,"type":"click"},{"id":2,"type":"view"}]`},
+		{collection: "store", key: "categories", count: 1, document: `{"categories":[{"id":"c1"}],"meta":{"version":1},"products":[{"id":1},{"id":2}]}`},
+		{collection: "store/products", key: "products", count: 2, document: `[{"id":1},{"id":2}]`},
+		{collection: "store.json/categories", key: "categories", count: 1, document: `[{"id":"c1"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.collection, func(t *testing.T) {
+			c, err := s.Collection(tt.collection)
+			if err != nil {
+				t.Fatalf("Collection(%q) error = %v", tt.collection, err)
+			}
+			if c.Key() != tt.key || c.Len() != tt.count {
+				t.Errorf("Expected key %q with %d records, got %q with %d", tt.key, tt.count, c.Key(), c.Len())
+			}
+
+			document, _ := json.Marshal(c.Document(c.Records()))
+			if string(document) != tt.document {
+				t.Errorf("Expected document %s, got %s", tt.document, document)
+			}
+		})
+	}
+
+	for _, name := range []string{"store/meta", "store/missing", "events/products", "store/", "store/a/b"} {
+		if _, err := s.Collection(name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for %q, got %v", name, err)
+		}
+	}
+
+	// Writing one array keeps the rest of the file and is seen by the other
+	// collections of the same file
+	categories, _ := s.Collection("store/categories")
+	if _, err := categories.Insert(map[string]interface{}{"id": "c2"}, ids.Auto()); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if c, _ := s.Collection("store"); c.Len() != 2 {
+		t.Errorf("Expected the default collection of the file to see the insert, got %d records", c.Len())
+	}
+
+	var stored map[string]interface{}
+	content, _ := os.ReadFile(filepath.Join(s.Dir(), "store.json"))
+	json.Unmarshal(content, &stored)
+	if len(stored["products"].([]interface{})) != 2 || len(stored["categories"].([]interface{})) != 2 || stored["meta"] == nil {
+		t.Errorf("Unexpected file content after insert: %s", content)
+	}
+
+	// Top-level arrays are written back as arrays
+	events, _ := s.Collection("events")
+	if err := events.Delete("1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	content, _ = os.ReadFile(filepath.Join(s.Dir(), "events.json"))
+	var array []interface{}
+	if err := json.Unmarshal(content, &array); err != nil || len(array) != 1 {
+		t.Errorf("Expected a top-level array with one record, got %s", content)
+	}
+
+	// Forgetting the file covers all of its collections
+	s.Forget("store")
+	if s.Loaded("store") {
+		t.Error("Expected every collection of the file to be forgotten")
+	}
+}
+
+// TestCollectionFormats tests collections backed by YAML files, which are
+// written back as YAML
+func TestCollectionFormats(t *testing.T) {
+	s := newTestStore(t, map[string]string{
+		"customers.yaml": "customers:\n  - id: 1\n    name: Emily\n",
+		"events.yml":     "- id: 1\n  type: click\n",
+		"products.json":  testProducts,
+		"products.yaml":  "products: []\n",
+	})
+
+	tests := []struct {
+		collection string
+		format     string
+		count      int
+	}{
+		{collection: "customers", format: files.FormatYAML, count: 1},
+		{collection: "customers.yaml", format: files.FormatYAML, count: 1},
+		{collection: "events", format: files.FormatYAML, count: 1},
+		{collection: "products", format: files.FormatJSON, count: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.collection, func(t *testing.T) {
+			c, err := s.Collection(tt.collection)
+			if err != nil {
+				t.Fatalf("Collection(%q) error = %v", tt.collection, err)
+			}
+			if c.Format() != tt.format || c.Len() != tt.count {
+				t.Errorf("Expected %s with %d records, got %s with %d", tt.format, tt.count, c.Format(), c.Len())
+			}
+		})
+	}
+
+	customers, _ := s.Collection("customers")
+	if _, err := customers.Insert(map[string]interface{}{"id": json.Number("2"), "name": "Omar"}, ids.Auto()); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(s.Dir(), "customers.yaml"))
+	expected := "customers:\n  - id: 1\n    name: Emily\n  - id: 2\n    name: Omar\n"
+	if string(content) != expected {
+		t.Errorf("Expected YAML file:\n%s\ngot:\n%s", expected, content)
+	}
+
+	for filename, expected := range map[string]bool{"events.yml": true, "customers.YAML": true, "notes.txt": false} {
+		if _, ok := CollectionName(filename); ok != expected {
+			t.Errorf("CollectionName(%q) = %v, expected %v", filename, ok, expected)
+		}
+	}
+}
+
+// TestCSVCollection tests that changes to a CSV collection are written back
+// with the file's column order
+func TestCSVCollection(t *testing.T) {
+	s := newTestStore(t, map[string]string{
+		"products.csv": "title,id,price,address.city\nLamp,1,12.50,Portland\nDesk,2,,\n",
+		"prices.tsv":   "id\tprice\n1\t9.99\n",
+	})
+
+	c, err := s.Collection("products")
+	if err != nil {
+		t.Fatalf("Collection(products) error = %v", err)
+	}
+	if c.Format() != files.FormatCSV || c.Len() != 2 {
+		t.Fatalf("Expected csv with 2 records, got %s with %d", c.Format(), c.Len())
+	}
+	lamp, _ := c.Get("1")
+	if lamp["price"] != json.Number("12.50") || lamp["address"].(map[string]interface{})["city"] != "Portland" {
+		t.Errorf("Unexpected record %v", lamp)
+	}
+
+	if _, err := c.Insert(map[string]interface{}{"title": "Chair", "stock": json.Number("4")}, ids.Auto()); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if err := c.Delete("2"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(s.Dir(), "products.csv"))
+	expected := "title,id,price,address.city,stock\nLamp,1,12.50,Portland,\nChair,3,,,4\n"
+	if string(content) != expected {
+		t.Errorf("Expected CSV file:\n%s\ngot:\n%s", expected, content)
+	}
+
+	prices, err := s.Collection("prices")
+	if err != nil {
+		t.Fatalf("Collection(prices) error = %v", err)
+	}
+	if _, err := prices.Update("1", func(record map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"id": record["id"], "price": json.Number("8.99")}, nil
+	}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	content, _ = os.ReadFile(filepath.Join(s.Dir(), "prices.tsv"))
+	if string(content) != "id\tprice\n1\t8.99\n" {
+		t.Errorf("Expected the change to be written as TSV, got:\n%s", content)
+	}
+}
+
+// TestNDJSONCollection tests streaming and appending to NDJSON files
+// without loading them
+func TestNDJSONCollection(t *testing.T) {
+	s := newTestStore(t, map[string]string{
+		"events.ndjson": "{\"id\": 1, \"type\": \"click\"}\n{\"id\": 2, \"type\": \"view\"}",
+		"logs.jsonl":    "",
+	})
+	auto := func(string) ids.Generator { return ids.Auto() }
+	path := filepath.Join(s.Dir(), "events.ndjson")
+
+	var types []interface{}
+	err := s.Stream("events", func(record map[string]interface{}) error {
+		types = append(types, record["type"])
+		return nil
+	})
+	if err != nil || fmt.Sprint(types) != "[click view]" {
+		t.Fatalf("Stream() = %v, %v", types, err)
+	}
+	if err := s.Stream("missing", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound streaming a missing collection, got %v", err)
+	}
+
+	// Appending to an unloaded file adds a line and leaves it unloaded
+	c, err := s.Append("events", map[string]interface{}{"type": "scroll"}, auto)
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if c.Name() != "events" || len(s.fileCollections("events")) != 0 {
+		t.Errorf("Expected events to stay unloaded")
+	}
+	content, _ := os.ReadFile(path)
+	expected := "{\"id\": 1, \"type\": \"click\"}\n{\"id\": 2, \"type\": \"view\"}\n{\"id\":3,\"type\":\"scroll\"}\n"
+	if string(content) != expected {
+		t.Errorf("Expected NDJSON file:\n%s\ngot:\n%s", expected, content)
+	}
+	if _, err := s.Append("events", map[string]interface{}{"id": json.Number("2")}, auto); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("Expected ErrDuplicateID, got %v", err)
+	}
+
+	// A loaded collection appends too, and rewrites the file for other changes
+	loaded, err := s.Collection("events")
+	if err != nil || loaded.Format() != files.FormatNDJSON || loaded.Len() != 3 {
+		t.Fatalf("Collection(events) = %v, error %v", loaded, err)
+	}
+	if _, err := s.Append("events", map[string]interface{}{"type": "close"}, auto); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	content, _ = os.ReadFile(path)
+	if !strings.HasPrefix(string(content), expected) || loaded.Len() != 4 {
+		t.Errorf("Expected a line to be appended, got:\n%s", content)
+	}
+	if err := loaded.Delete("1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	content, _ = os.ReadFile(path)
+	expected = "{\"id\":2,\"type\":\"view\"}\n{\"id\":3,\"type\":\"scroll\"}\n{\"id\":4,\"type\":\"close\"}\n"
+	if string(content) != expected {
+		t.Errorf("Expected NDJSON file:\n%s\ngot:\n%s", expected, content)
+	}
+
+	if _, err := s.Append("logs", map[string]interface{}{"level": "info"}, auto); err != nil {
+		t.Fatalf("Append() to an empty file error = %v", err)
+	}
+	content, _ = os.ReadFile(filepath.Join(s.Dir(), "logs.jsonl"))
+	if string(content) != "{\"id\":1,\"level\":\"info\"}\n" {
+		t.Errorf("Unexpected JSON Lines file:\n%s", content)
+	}
+}
+
+// TestNDJSONTornLine tests that a final line left incomplete by an
+// interrupted append is skipped when reading and replaced when appending
+func TestNDJSONTornLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		loaded   bool
+		expected string
+	}{
+		{name: "Torn line", content: "{\"id\": 1}\n{\"id\": 2, \"ty", expected: "{\"id\": 1}\n{\"id\":2,\"type\":\"scroll\"}\n"},
+		{name: "Torn line in a loaded collection", content: "{\"id\": 1}\n{\"id\": 2, \"ty", loaded: true, expected: "{\"id\": 1}\n{\"id\":2,\"type\":\"scroll\"}\n"},
+		{name: "Only a torn line", content: "{\"id\": 1", expected: "{\"id\":1,\"type\":\"scroll\"}\n"},
+		{name: "Long torn line", content: "{\"id\": 1}\n{\"id\": 2, \"note\": \"" + strings.Repeat("x", 10000), expected: "{\"id\": 1}\n{\"id\":2,\"type\":\"scroll\"}\n"},
+		{name: "Complete line without a newline", content: "{\"id\": 1}", expected: "{\"id\": 1}\n{\"id\":2,\"type\":\"scroll\"}\n"},
+		{name: "Trailing spaces", content: "{\"id\": 1}\n  ", expected: "{\"id\": 1}\n{\"id\":2,\"type\":\"scroll\"}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t, map[string]string{"events.ndjson": tt.content})
+
+			if tt.loaded {
+				c, err := s.Collection("events")
+				if err != nil {
+					t.Fatalf("Collection() error = %v", err)
+				}
+				if _, err := c.Insert(map[string]interface{}{"type": "scroll"}, ids.Auto()); err != nil {
+					t.Fatalf("Insert() error = %v", err)
+				}
+			} else if _, err := s.Append("events", map[string]interface{}{"type": "scroll"}, func(string) ids.Generator { return ids.Auto() }); err != nil {
+				t.Fatalf("Append() error = %v", err)
+			}
+
+			content, _ := os.ReadFile(filepath.Join(s.Dir(), "events.ndjson"))
+			if string(content) != tt.expected {
+				t.Errorf("Expected NDJSON file:\n%s\ngot:\n%s", tt.expected, content)
+			}
+		})
+	}
+}
+
+// TestSingleton tests files holding a single object rather than records
+func TestSingleton(t *testing.T) {
+	s := newTestStore(t, map[string]string{
+		"settings.json": `{"theme": "dark", "languages": ["en", "fr"], "editor": {"fontSize": 12}}`,
+		"catalog.json":  `{"products": [], "version": 2}`,
+	})
+
+	catalog, err := s.Collection("catalog")
+	if err != nil {
+		t.Fatalf("Collection(catalog) error = %v", err)
+	}
+	if catalog.IsSingleton() || catalog.Key() != "products" {
+		t.Error("Expected an empty array of records to make a collection")
+	}
+
+	c, err := s.Collection("settings")
+	if err != nil {
+		t.Fatalf("Collection(settings) error = %v", err)
+	}
+	if !c.IsSingleton() || c.Len() != 0 || c.HasArray("languages") {
+		t.Fatal("Expected an object without arrays of records to be a singleton")
+	}
+	if c.Object()["theme"] != "dark" {
+		t.Errorf("Unexpected object %v", c.Object())
+	}
+
+	// Record operations don't apply to singletons
+	if _, err := c.Insert(map[string]interface{}{"id": 1}, ids.Auto()); !errors.Is(err, ErrSingleton) {
+		t.Errorf("Expected ErrSingleton from Insert, got %v", err)
+	}
+	if err := c.Delete("theme"); !errors.Is(err, ErrSingleton) {
+		t.Errorf("Expected ErrSingleton from Delete, got %v", err)
+	}
+
+	// A failed replacement leaves the object alone
+	if _, err := c.Replace(func(current map[string]interface{}) (map[string]interface{}, error) {
+		return nil, errors.New("rejected")
+	}); err == nil || c.Object()["theme"] != "dark" {
+		t.Errorf("Expected the object to be kept after a failed update, got %v, %v", c.Object(), err)
+	}
+
+	object, err := c.Replace(func(current map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"theme": "light", "editor": current["editor"]}, nil
+	})
+	if err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if object["theme"] != "light" || c.Object()["languages"] != nil {
+		t.Errorf("Unexpected object after Replace: %v", c.Object())
+	}
+
+	content, _ := os.ReadFile(filepath.Join(s.Dir(), "settings.json"))
+	var stored map[string]interface{}
+	if err := json.Unmarshal(content, &stored); err != nil || stored["theme"] != "light" || stored["editor"] == nil {
+		t.Errorf("Unexpected file content after Replace: %s", content)
+	}
+}
+
+// TestIDFields tests collections identified by other fields than id,
+// including composite keys
+func TestIDFields(t *testing.T) {
+	s := newTestStore(t, map[string]string{
+		"products.json": `{"products": [{"sku": "A-1", "id": 9}, {"sku": "B-2"}]}`,
+		"lines.json":    `[{"orderId": 1001, "lineNo": 1, "qty": 2}, {"orderId": 1001, "lineNo": 2, "qty": 1}]`,
+		"users.json":    `{"users": [{"_id": "u1"}]}`,
+	})
+
+	if err := s.SetIDFields("", []string{"_id"}); err != nil {
+		t.Fatalf("SetIDFields() error = %v", err)
+	}
+	if err := s.SetIDFields("products.json", []string{"sku"}); err != nil {
+		t.Fatalf("SetIDFields() error = %v", err)
+	}
+	if err := s.SetIDFields("lines", []string{"orderId", "lineNo"}); err != nil {
+		t.Fatalf("SetIDFields() error = %v", err)
+	}
+	if err := s.SetIDFields("lines", []string{"orderId", ""}); err == nil {
+		t.Error("Expected an error for an empty id field")
+	}
+
+	tests := []struct {
+		collection string
+		id         string
+		field      string
+		expected   interface{}
+	}{
+		{collection: "products", id: "B-2", field: "sku", expected: "B-2"},
+		{collection: "lines", id: "1001,2", field: "qty", expected: json.Number("1")},
+		{collection: "users", id: "u1", field: "_id", expected: "u1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.collection, func(t *testing.T) {
+			c, err := s.Collection(tt.collection)
+			if err != nil {
+				t.Fatalf("Collection(%q) error = %v", tt.collection, err)
+			}
+			record, ok := c.Get(tt.id)
+			if !ok || record[tt.field] != tt.expected {
+				t.Errorf("Get(%q) = %v, %v", tt.id, record, ok)
+			}
+		})
+	}
+
+	// Composite keys can't be generated
+	lines, _ := s.Collection("lines")
+	if _, err := lines.Insert(map[string]interface{}{"orderId": 1002}, ids.Auto()); !errors.Is(err, ErrMissingID) {
+		t.Errorf("Expected ErrMissingID, got %v", err)
+	}
+	if _, err := lines.Insert(map[string]interface{}{"orderId": 1001, "lineNo": 1}, ids.Auto()); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("Expected ErrDuplicateID, got %v", err)
+	}
+
+	// Generated ids go to the id field, and updates keep every id field
+	products, _ := s.Collection("products")
+	record, err := products.Insert(map[string]interface{}{"title": "Lamp"}, ids.Auto())
+	if err != nil || record["sku"] == nil || record["id"] != nil {
+		t.Errorf("Expected a generated sku, got %v, %v", record, err)
+	}
+	updated, err := lines.Update("1001,2", func(current map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"qty": 5}, nil
+	})
+	if err != nil || lines.RecordID(updated) != "1001,2" || lines.IDValue(updated) != "1001,2" {
+		t.Errorf("Expected the key to be kept, got %v, %v", updated, err)
+	}
+	if id := products.IDValue(map[string]interface{}{"sku": "A-1"}); id != "A-1" {
+		t.Errorf("Expected IDValue A-1, got %v", id)
+	}
+}
+
+// TestCollectionWrites tests that changes are applied in memory and written to disk
+func TestCollectionWrites(t *testing.T) {
+	s := newTestStore(t, map[string]string{"products.json": testProducts})
+	c, err := s.Collection("products")
+	if err != nil {
+		t.Fatalf("Collection() error = %v", err)
+	}
+
+	if _, err := c.Insert(map[string]interface{}{"title": "Headphones"}, ids.Increment()); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if _, err := c.Insert(map[string]interface{}{"id": json.Number("2")}, ids.Increment()); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("Expected ErrDuplicateID, got %v", err)
+	}
+
+	_, err = c.Update("1", func(current map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"id": "ignored", "title": "Laptop"}, nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if _, err := c.Update("9", nil); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound, got %v", err)
+	}
+
+	if err := c.Delete("2"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := c.Delete("2"); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound, got %v", err)
+	}
+
+	// The index must follow the records after a delete
+	expected := map[string]string{"1": "Laptop", "3": "SmartLife Fitness Watch", "4": "Headphones"}
+	for id, title := range expected {
+		record, ok := c.Get(id)
+		if !ok || record["title"] != title {
+			t.Errorf("Get(%s) = %v, want title %q", id, record, title)
+		}
+	}
+
+	// A fresh store sees the same records on disk
+	reloaded, err := New(s.Dir()).Collection("products")
+	if err != nil {
+		t.Fatalf("Collection() error = %v", err)
+	}
+	if reloaded.Len() != len(expected) {
+		t.Fatalf("Expected %d records on disk, got %d", len(expected), reloaded.Len())
+	}
+	for id, title := range expected {
+		if record, ok := reloaded.Get(id); !ok || record["title"] != title {
+			t.Errorf("On disk Get(%s) = %v, want title %q", id, record, title)
+		}
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if c.Len() != 0 {
+		t.Errorf("Expected no records after Clear, got %d", c.Len())
+	}
+
+	if err := s.Remove("products"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := s.Collection("products"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after Remove, got %v", err)
+	}
+}
+
+// TestRemoveSubCollection tests that removing one array of a file keeps the
+// others and the file itself
+func TestRemoveSubCollection(t *testing.T) {
+	s := newTestStore(t, map[string]string{
+		"store.json": `{"products": [{"id": 1}], "categories": [{"id": 1, "name": "Lighting"}], "version": 2}`,
+	})
+	if _, err := s.Collection("store/categories"); err != nil {
+		t.Fatalf("Collection() error = %v", err)
+	}
+
+	if err := s.Remove("store/products"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := s.Collection("store/products"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after Remove, got %v", err)
+	}
+	categories, err := s.Collection("store/categories")
+	if err != nil || categories.Len() != 1 {
+		t.Fatalf("Expected the other array to be kept, got %v, error %v", categories, err)
+	}
+	content, _ := os.ReadFile(filepath.Join(s.Dir(), "store.json"))
+	expected := "{\n  \"categories\": [\n    {\n      \"id\": 1,\n      \"name\": \"Lighting\"\n    }\n  ],\n  \"version\": 2\n}\n"
+	if string(content) != expected {
+		t.Errorf("Expected store.json:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
+// TestCollectionPicksUpExternalChanges tests that a write reloads the file first
+// if another process changed it, so that change isn't lost
+func TestCollectionPicksUpExternalChanges(t *testing.T) {
+	s := newTestStore(t, map[string]string{"products.json": testProducts})
+	c, err := s.Collection("products")
+	if err != nil {
+		t.Fatalf("Collection() error = %v", err)
+	}
+
+	// Another process adds a record
+	changed := strings.Replace(testProducts, `"price": 89.99}`, `"price": 89.99},
+    {"id": 7, "title": "Written elsewhere"}`, 1)
+	path := filepath.Join(s.Dir(), "products.json")
+	if err := os.WriteFile(path, []byte(changed), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+
+	if _, err := c.Insert(map[string]interface{}{}, ids.Increment()); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	if _, ok := c.Get("7"); !ok {
+		t.Error("Expected the externally added record to be kept")
+	}
+	if _, ok := c.Get("8"); !ok {
+		t.Error("Expected the new record to follow the externally added one")
+	}
+}
+
+// TestCollectionConcurrentInserts tests that concurrent writers don't lose records
+func TestCollectionConcurrentInserts(t *testing.T) {
+	s := newTestStore(t, map[string]string{"products.json": testProducts})
+	c, err := s.Collection("products")
+	if err != nil {
+		t.Fatalf("Collection() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Insert(map[string]interface{}{}, ids.Increment()); err != nil {
+				t.Errorf("Insert() error = %v", err)
+			}
+			c.Get("1")
+			c.Records()
+		}()
+	}
+	wg.Wait()
+
+	reloaded, err := New(s.Dir()).Collection("products")
+	if err != nil {
+		t.Fatalf("Collection() error = %v", err)
+	}
+	if reloaded.Len() != 23 {
+		t.Errorf("Expected 23 records on disk, got %d", reloaded.Len())
+	}
+}
+
+// TestCollectionConcurrentLoads tests that concurrent first uses share one
+// load and that a file that fails to load is read again on the next use
+func TestCollectionConcurrentLoads(t *testing.T) {
+	s := newTestStore(t, map[string]string{
+		"products.json":  testProducts,
+		"customers.json": `[{"id": 1}]`,
+		"broken.json":    `[{"id": 1}`,
+	})
+
+	var wg sync.WaitGroup
+	loaded := make([]*Collection, 20)
+	for i := range loaded {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := []string{"products", "customers"}[i%2]
+			c, err := s.Collection(name)
+			if err != nil {
+				t.Errorf("Collection(%s) error = %v", name, err)
+				return
+			}
+			loaded[i] = c
+			if _, err := s.Collection("broken"); err == nil {
+				t.Error("Expected an error loading an invalid file")
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, c := range loaded {
+		if c != loaded[i%2] {
+			t.Errorf("Expected every caller to get the same collection for %s", c.Name())
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(s.Dir(), "broken.json"), []byte(`[{"id": 1}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := s.Collection("broken"); err != nil || c.Len() != 1 {
+		t.Errorf("Expected the fixed file to load, got error %v", err)
+	}
+}
+
+// benchmarkRecords is the number of records in the benchmark collection
+const benchmarkRecords = 100_000
+
+// writeBenchmarkFile creates a products.json file with benchmarkRecords records
+func writeBenchmarkFile(b *testing.B) *Store {
+	b.Helper()
+
+	var sb strings.Builder
+	sb.WriteString(`{"products": [`)
+	for i := 1; i <= benchmarkRecords; i++ {
+		if i > 1 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, `{"id": %d, "sku": "TECH-%06d", "title": "Product %d", "quantity": %d, "price": %d.99}`, i, i, i, i%100, i%1000)
+	}
+	sb.WriteString("]}")
+
+	return newTestStore(b, map[string]string{"products.json": sb.String()})
+}
+
+// BenchmarkGet measures looking up a record through the store's id index
+func BenchmarkGet(b *testing.B) {
+	s := writeBenchmarkFile(b)
+	if _, err := s.Collection("products"); err != nil {
+		b.Fatalf("Collection() error = %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, err := s.Collection("products")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, ok := c.Get(fmt.Sprint(benchmarkRecords - i%1000)); !ok {
+			b.Fatal("record not found")
+		}
+	}
+}
+
+// BenchmarkGetFromFile measures the lookup the store replaces: reading and
+// decoding the whole file, then scanning the records for the id
+func BenchmarkGetFromFile(b *testing.B) {
+	s := writeBenchmarkFile(b)
+	path := filepath.Join(s.Dir(), "products.json")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := os.Stat(path); err != nil {
+			b.Fatal(err)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var data map[string][]map[string]interface{}
+		if err := json.Unmarshal(content, &data); err != nil {
+			b.Fatal(err)
+		}
+
+		id := fmt.Sprint(benchmarkRecords - i%1000)
+		found := false
+		for _, record := range data["products"] {
+			if fmt.Sprintf("%v", record["id"]) == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			b.Fatal("record not found")
+		}
+	}
+}
+
+// BenchmarkRecords measures taking a snapshot of all records for a collection request
+func BenchmarkRecords(b *testing.B) {
+	s := writeBenchmarkFile(b)
+	c, err := s.Collection("products")
+	if err != nil {
+		b.Fatalf("Collection() error = %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(c.Records()) != benchmarkRecords {
+			b.Fatal("unexpected record count")
+		}
+	}
+}
+
+// BenchmarkLoad measures the one-off cost of parsing and indexing the collection
+func BenchmarkLoad(b *testing.B) {
+	s := writeBenchmarkFile(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := New(s.Dir()).Collection("products"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSearch measures a full-text search through the collection's index
+func BenchmarkSearch(b *testing.B) {
+	s := writeBenchmarkFile(b)
+	c, err := s.Collection("products")
+	if err != nil {
+		b.Fatalf("Collection() error = %v", err)
+	}
+	search, _ := query.ParseSearch(url.Values{"q": {"tech-0999"}})
+	c.Indexed()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		records, index := c.Indexed()
+		if len(search.Filter(records, index)) != 100 {
+			b.Fatal("unexpected match count")
+		}
+	}
+}
+
+// BenchmarkSearchWithoutIndex measures the same search scanning every record
+func BenchmarkSearchWithoutIndex(b *testing.B) {
+	s := writeBenchmarkFile(b)
+	c, err := s.Collection("products")
+	if err != nil {
+		b.Fatalf("Collection() error = %v", err)
+	}
+	search, _ := query.ParseSearch(url.Values{"q": {"tech-0999"}})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(search.Filter(c.Records(), nil)) != 100 {
+			b.Fatal("unexpected match count")
+		}
+	}
+}
+
+// TestIndexedRebuilt tests that the search index follows changes to the collection
+func TestIndexedRebuilt(t *testing.T) {
+	s := newTestStore(t, map[string]string{"products.json": testProducts})
+	c, err := s.Collection("products")
+	if err != nil {
+		t.Fatalf("Collection() error = %v", err)
+	}
+	search, _ := query.ParseSearch(url.Values{"q": {"kettle"}})
+
+	count := func() int {
+		records, index := c.Indexed()
+		return len(search.Filter(records, index))
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("Expected no matches, got %d", n)
+	}
+
+	if _, err := c.Insert(map[string]interface{}{"title": "Electric Kettle"}, ids.Increment()); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("Expected the inserted record to be found, got %d matches", n)
+	}
+
+	// Reloading an edited file rebuilds the index too
+	path := filepath.Join(s.Dir(), "products.json")
+	if err := os.WriteFile(path, []byte(`{"products": [{"id": 1, "title": "Kettle"}, {"id": 2, "title": "Kettle Lid"}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	os.Chtimes(path, modTime, modTime)
+	if _, err := s.Refresh("products"); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("Expected both reloaded records to be found, got %d matches", n)
+	}
+}
+
+// TestRefresh tests reloading collections after their files change
+func TestRefresh(t *testing.T) {
+	s := newTestStore(t, map[string]string{"products.json": testProducts})
+	path := filepath.Join(s.Dir(), "products.json")
+
+	// Collections that aren't loaded are left alone
+	if reloaded, err := s.Refresh("products"); reloaded || err != nil {
+		t.Errorf("Refresh() of unloaded collection = %v, %v", reloaded, err)
+	}
+
+	c, err := s.Collection("products")
+	if err != nil {
+		t.Fatalf("Collection() error = %v", err)
+	}
+	if !s.Loaded("products") {
+		t.Error("Expected collection to be loaded")
+	}
+
+	// Unchanged files, including the store's own writes, aren't reloaded
+	if _, err := c.Insert(map[string]interface{}{}, ids.Increment()); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if reloaded, err := s.Refresh("products"); reloaded || err != nil {
+		t.Errorf("Refresh() after own write = %v, %v", reloaded, err)
+	}
+
+	setFile := func(content string, offset time.Duration) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		modTime := time.Now().Add(offset)
+		os.Chtimes(path, modTime, modTime)
+	}
+
+	setFile(`{"products": [{"id": 1, "title": "Edited"}]}`, time.Minute)
+	if reloaded, err := s.Refresh("products"); !reloaded || err != nil {
+		t.Fatalf("Refresh() after edit = %v, %v", reloaded, err)
+	}
+	if record, _ := c.Get("1"); record["title"] != "Edited" || c.Len() != 1 {
+		t.Errorf("Expected the edited record, got %v (%d records)", record, c.Len())
+	}
+
+	setFile(`{"products": [`, 2*time.Minute)
+	if _, err := s.Refresh("products"); err == nil {
+		t.Error("Expected an error for a broken file")
+	}
+	if record, _ := c.Get("1"); record["title"] != "Edited" {
+		t.Errorf("Expected the previous version to be kept, got %v", record)
+	}
+
+	os.Remove(path)
+	if reloaded, err := s.Refresh("products"); !reloaded || err != nil {
+		t.Errorf("Refresh() after removal = %v, %v", reloaded, err)
+	}
+	if s.Loaded("products") {
+		t.Error("Expected a removed collection to be forgotten")
+	}
+}
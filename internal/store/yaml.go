@@ -0,0 +1,192 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeYAML parses a YAML document into the same values DecodeJSON
+// produces, so YAML and JSON collections behave alike: mappings become
+// map[string]interface{}, sequences []interface{} and numbers json.Number.
+// Timestamps and other scalars JSON can't represent are kept as the strings
+// they were written as. Aliases are resolved and merge keys ("<<") applied.
+func decodeYAML(content []byte) (interface{}, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		return nil, fmt.Errorf("empty document")
+	}
+	return yamlValue(&doc)
+}
+
+// yamlValue converts a YAML node to its decoded JSON form.
+func yamlValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return yamlValue(node.Content[0])
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+	case yaml.SequenceNode:
+		values := make([]interface{}, len(node.Content))
+		for i, child := range node.Content {
+			value, err := yamlValue(child)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case yaml.MappingNode:
+		return yamlMapping(node)
+	}
+
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		err := node.Decode(&b)
+		return b, err
+	case "!!int":
+		var i int64
+		if err := node.Decode(&i); err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatInt(i, 10)), nil
+	case "!!float":
+		var f float64
+		if err := node.Decode(&f); err != nil {
+			return nil, err
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return node.Value, nil
+		}
+		if json.Valid([]byte(node.Value)) {
+			return json.Number(node.Value), nil
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	}
+	return node.Value, nil
+}
+
+// yamlMapping converts a YAML mapping to an object. Keys are used as
+// written; the members of a merge key are added unless the mapping sets them
+// itself.
+func yamlMapping(node *yaml.Node) (map[string]interface{}, error) {
+	object := make(map[string]interface{}, len(node.Content)/2)
+	var merged []map[string]interface{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, valueNode := node.Content[i], node.Content[i+1]
+		value, err := yamlValue(valueNode)
+		if err != nil {
+			return nil, err
+		}
+
+		if key.ShortTag() == "!!merge" {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				merged = append(merged, v)
+			case []interface{}:
+				for _, element := range v {
+					if m, ok := element.(map[string]interface{}); ok {
+						merged = append(merged, m)
+					}
+				}
+			}
+			continue
+		}
+		if key.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: mapping keys must be scalars", key.Line)
+		}
+		object[key.Value] = value
+	}
+
+	for _, m := range merged {
+		for k, v := range m {
+			if _, ok := object[k]; !ok {
+				object[k] = v
+			}
+		}
+	}
+	return object, nil
+}
+
+// encodeYAML writes a decoded JSON value as a YAML document indented by two
+// spaces. Object keys are sorted, as they are in JSON files.
+func encodeYAML(doc interface{}) ([]byte, error) {
+	node, err := yamlNode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlNode converts a decoded JSON value to a YAML node.
+func yamlNode(value interface{}) (*yaml.Node, error) {
+	scalar := func(tag, s string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: s}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return scalar("!!null", "null"), nil
+	case string:
+		return scalar("!!str", v), nil
+	case bool:
+		return scalar("!!bool", strconv.FormatBool(v)), nil
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return scalar("!!int", v.String()), nil
+		}
+		return scalar("!!float", v.String()), nil
+	case float64:
+		return scalar("!!float", strconv.FormatFloat(v, 'g', -1, 64)), nil
+	case int:
+		return scalar("!!int", strconv.Itoa(v)), nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, element := range v {
+			child, err := yamlNode(element)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, key := range keys {
+			child, err := yamlNode(v[key])
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, scalar("!!str", key), child)
+		}
+		return node, nil
+	}
+	return nil, fmt.Errorf("can't write %T as YAML", value)
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestDecodeYAML tests that YAML documents decode to the same values as JSON
+func TestDecodeYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "Scalars",
+			yaml:     "id: 1\nprice: 12.50\nbig: 1e3\nhex: 0x1F\nactive: true\nnote: ~\nname: Lamp\nquoted: \"42\"",
+			expected: map[string]interface{}{"id": json.Number("1"), "price": json.Number("12.50"), "big": json.Number("1e3"), "hex": json.Number("31"), "active": true, "note": nil, "name": "Lamp", "quoted": "42"},
+		},
+		{
+			name:     "Timestamps stay strings",
+			yaml:     "created: 2024-01-02T10:00:00Z\nday: 2024-01-02",
+			expected: map[string]interface{}{"created": "2024-01-02T10:00:00Z", "day": "2024-01-02"},
+		},
+		{
+			name:     "Nested collections",
+			yaml:     "customers:\n  - id: 1\n    tags: [a, b]\n    address:\n      city: Portland\n",
+			expected: map[string]interface{}{"customers": []interface{}{map[string]interface{}{"id": json.Number("1"), "tags": []interface{}{"a", "b"}, "address": map[string]interface{}{"city": "Portland"}}}},
+		},
+		{
+			name:     "Anchors and merge keys",
+			yaml:     "base: &base {city: Portland, state: OR}\nhome:\n  <<: *base\n  city: Salem\ncopy: *base",
+			expected: map[string]interface{}{"base": map[string]interface{}{"city": "Portland", "state": "OR"}, "home": map[string]interface{}{"city": "Salem", "state": "OR"}, "copy": map[string]interface{}{"city": "Portland", "state": "OR"}},
+		},
+		{name: "Top-level array", yaml: "- id: 1\n- id: 2", expected: []interface{}{map[string]interface{}{"id": json.Number("1")}, map[string]interface{}{"id": json.Number("2")}}},
+		{name: "Empty document", yaml: "", wantErr: true},
+		{name: "Invalid YAML", yaml: "a: [1, 2", wantErr: true},
+		{name: "Complex key", yaml: "? [a, b]\n: 1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeYAML([]byte(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeYAML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %#v, got %#v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestEncodeYAML tests that written YAML reads back as the same values
+func TestEncodeYAML(t *testing.T) {
+	doc := map[string]interface{}{
+		"customers": []interface{}{
+			map[string]interface{}{
+				"id":      json.Number("1"),
+				"price":   json.Number("12.5"),
+				"zip":     "97301",
+				"since":   "2024-01-02",
+				"active":  false,
+				"note":    nil,
+				"address": map[string]interface{}{"city": "Portland"},
+			},
+		},
+	}
+
+	content, err := encodeYAML(doc)
+	if err != nil {
+		t.Fatalf("encodeYAML() error = %v", err)
+	}
+	expected := `customers:
+  - active: false
+    address:
+      city: Portland
+    id: 1
+    note: null
+    price: 12.5
+    since: "2024-01-02"
+    zip: "97301"
+`
+	if string(content) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, content)
+	}
+
+	decoded, err := decodeYAML(content)
+	if err != nil {
+		t.Fatalf("decodeYAML() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, doc) {
+		t.Errorf("Expected %v to round-trip, got %v", doc, decoded)
+	}
+}
@@ -0,0 +1,90 @@
+//go:build linux
+
+package watch
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask selects the directory changes reported by inotify. Writes are
+// reported when the writer closes the file, so a file is only reported once
+// it is complete.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO |
+	syscall.IN_MOVED_FROM | syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// newNotify watches dir with inotify.
+func newNotify(dir string) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dir, inotifyMask); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	// Wrapping the non-blocking descriptor in an os.File lets reads wait in the
+	// runtime poller, and lets Close interrupt a pending read.
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	w := newWatcher("inotify")
+	w.stop = f.Close
+	w.wg.Add(1)
+	go w.readNotify(f)
+	return w, nil
+}
+
+// readNotify reads inotify events from f until the watcher is closed.
+func (w *Watcher) readNotify(f *os.File) {
+	defer w.wg.Done()
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return
+			}
+			if !w.sendError(err) {
+				return
+			}
+			continue
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(raw.Len)]
+			offset += syscall.SizeofInotifyEvent + int(raw.Len)
+
+			if raw.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 {
+				if !w.sendError(errors.New("watched directory was removed or moved")) {
+					return
+				}
+				continue
+			}
+			if raw.Mask&syscall.IN_ISDIR != 0 {
+				continue
+			}
+
+			event := Event{Name: string(bytes.TrimRight(nameBytes, "\x00"))}
+			switch {
+			case raw.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+				event.Op = Create
+			case raw.Mask&syscall.IN_CLOSE_WRITE != 0:
+				event.Op = Write
+			case raw.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+				event.Op = Remove
+			default:
+				continue
+			}
+
+			if !w.send(event) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+// newNotify reports that inotify is not available, so New falls back to polling.
+func newNotify(dir string) (*Watcher, error) {
+	return nil, errors.New("inotify is not supported on this platform")
+}
@@ -0,0 +1,90 @@
+package watch
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+// fileState identifies a version of a file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// scan records the state of every file directly inside dir.
+func scan(dir string) (map[string]fileState, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[string]fileState, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// The file was removed between listing and stat
+			continue
+		}
+		snapshot[entry.Name()] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+	return snapshot, nil
+}
+
+// poll rescans dir every interval and reports the differences between scans.
+func (w *Watcher) poll(dir string, interval time.Duration, previous map[string]fileState) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		current, err := scan(dir)
+		if err != nil {
+			if !w.sendError(err) {
+				return
+			}
+			continue
+		}
+
+		for _, event := range diff(previous, current) {
+			if !w.send(event) {
+				return
+			}
+		}
+		previous = current
+	}
+}
+
+// diff lists the changes between two scans, ordered by file name.
+func diff(previous, current map[string]fileState) []Event {
+	var events []Event
+	for name, state := range current {
+		old, ok := previous[name]
+		switch {
+		case !ok:
+			events = append(events, Event{Name: name, Op: Create})
+		case !old.modTime.Equal(state.modTime) || old.size != state.size:
+			events = append(events, Event{Name: name, Op: Write})
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			events = append(events, Event{Name: name, Op: Remove})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Name < events[j].Name
+	})
+	return events
+}
@@ -0,0 +1,158 @@
+// Package watch reports changes to the files directly inside a directory.
+// On Linux it uses inotify; elsewhere, or when asked to, it polls the
+// directory at a fixed interval.
+package watch
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultInterval is the polling interval used when inotify is not available.
+const DefaultInterval = time.Second
+
+// Op describes the kind of change made to a file.
+type Op int
+
+const (
+	// Create means the file appeared, by being created or renamed into the directory.
+	Create Op = iota + 1
+	// Write means the file's contents changed.
+	Write
+	// Remove means the file disappeared, by being deleted or renamed out of the directory.
+	Remove
+)
+
+// String returns a lowercase name for the operation.
+func (op Op) String() string {
+	switch op {
+	case Create:
+		return "create"
+	case Write:
+		return "write"
+	case Remove:
+		return "remove"
+	}
+	return "unknown"
+}
+
+// Event is a change to a single file.
+type Event struct {
+	// Name is the file name, without directory.
+	Name string
+	Op   Op
+}
+
+// Watcher delivers changes to the files in a directory on its Events channel.
+// Errors that don't stop the watcher are delivered on Errors. Both channels
+// are closed once the watcher has been closed.
+type Watcher struct {
+	Events <-chan Event
+	Errors <-chan error
+
+	events chan Event
+	errors chan error
+	done   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+	mode   string
+	stop   func() error
+}
+
+// New watches the files directly inside dir, using inotify if the platform
+// supports it and polling every DefaultInterval otherwise.
+//
+// Parameters:
+//   - dir: The directory to watch
+//
+// Returns:
+//   - *Watcher: The running watcher
+//   - error: An error if the directory can't be watched
+func New(dir string) (*Watcher, error) {
+	w, err := newNotify(dir)
+	if err == nil {
+		return w, nil
+	}
+	return NewPolling(dir, DefaultInterval)
+}
+
+// NewPolling watches the files directly inside dir by comparing their size
+// and modification time every interval. It works on every platform and file
+// system, including network mounts where inotify reports nothing.
+//
+// Parameters:
+//   - dir: The directory to watch
+//   - interval: How often to scan the directory
+//
+// Returns:
+//   - *Watcher: The running watcher
+//   - error: An error if the directory can't be read
+func NewPolling(dir string, interval time.Duration) (*Watcher, error) {
+	snapshot, err := scan(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newWatcher("polling")
+	w.wg.Add(1)
+	go w.poll(dir, interval, snapshot)
+	return w, nil
+}
+
+// Mode returns how the watcher detects changes: "inotify" or "polling".
+func (w *Watcher) Mode() string {
+	return w.mode
+}
+
+// Close stops the watcher and waits for it to finish. The Events and Errors
+// channels are closed afterwards.
+//
+// Returns:
+//   - error: An error if releasing the watcher's resources fails
+func (w *Watcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		if w.stop != nil {
+			err = w.stop()
+		}
+		w.wg.Wait()
+		close(w.events)
+		close(w.errors)
+	})
+	return err
+}
+
+// newWatcher creates a Watcher with its channels set up.
+func newWatcher(mode string) *Watcher {
+	events := make(chan Event, 64)
+	errors := make(chan error, 8)
+	return &Watcher{
+		Events: events,
+		Errors: errors,
+		events: events,
+		errors: errors,
+		done:   make(chan struct{}),
+		mode:   mode,
+	}
+}
+
+// send delivers an event unless the watcher is closing.
+func (w *Watcher) send(event Event) bool {
+	select {
+	case w.events <- event:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// sendError delivers an error unless the watcher is closing.
+func (w *Watcher) sendError(err error) bool {
+	select {
+	case w.errors <- err:
+		return true
+	case <-w.done:
+		return false
+	}
+}
@@ -0,0 +1,125 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// expectEvents waits until all the expected events have been seen, in any
+// order, skipping unrelated events
+func expectEvents(t *testing.T, w *Watcher, expected ...Event) {
+	t.Helper()
+
+	pending := make(map[Event]bool, len(expected))
+	for _, event := range expected {
+		pending[event] = true
+	}
+
+	timeout := time.After(5 * time.Second)
+	for len(pending) > 0 {
+		select {
+		case event := <-w.Events:
+			delete(pending, event)
+		case err := <-w.Errors:
+			t.Fatalf("Watcher error: %v", err)
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %v", pending)
+		}
+	}
+}
+
+// TestWatcher tests that file changes are reported by both watcher modes
+func TestWatcher(t *testing.T) {
+	modes := map[string]func(dir string) (*Watcher, error){
+		"polling": func(dir string) (*Watcher, error) {
+			return NewPolling(dir, 10*time.Millisecond)
+		},
+	}
+	if runtime.GOOS == "linux" {
+		modes["inotify"] = newNotify
+	}
+
+	for mode, newWatcher := range modes {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			products := filepath.Join(dir, "products.json")
+			if err := os.WriteFile(products, []byte(`{"products": []}`), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+
+			w, err := newWatcher(dir)
+			if err != nil {
+				t.Fatalf("Failed to start watcher: %v", err)
+			}
+			defer w.Close()
+
+			if w.Mode() != mode {
+				t.Errorf("Expected mode %s, got %s", mode, w.Mode())
+			}
+
+			// Modification times may not change within a coarse timestamp
+			// granularity, so writes also change the size
+			if err := os.WriteFile(products, []byte(`{"products": [{"id": 1}]}`), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+			expectEvents(t, w, Event{Name: "products.json", Op: Write})
+
+			orders := filepath.Join(dir, "orders.json")
+			if err := os.WriteFile(orders, []byte(`{"orders": []}`), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+			expectEvents(t, w, Event{Name: "orders.json", Op: Create})
+
+			if err := os.Rename(orders, filepath.Join(dir, "invoices.json")); err != nil {
+				t.Fatalf("Failed to rename file: %v", err)
+			}
+			expectEvents(t, w, Event{Name: "orders.json", Op: Remove}, Event{Name: "invoices.json", Op: Create})
+
+			if err := os.Remove(products); err != nil {
+				t.Fatalf("Failed to remove file: %v", err)
+			}
+			expectEvents(t, w, Event{Name: "products.json", Op: Remove})
+
+			if err := w.Close(); err != nil {
+				t.Errorf("Close() error = %v", err)
+			}
+			// The channels are closed once the watcher has stopped
+			for range w.Events {
+			}
+		})
+	}
+}
+
+// TestDiff tests the comparison of directory scans used by the polling watcher
+func TestDiff(t *testing.T) {
+	now := time.Now()
+	previous := map[string]fileState{
+		"a.json": {modTime: now, size: 10},
+		"b.json": {modTime: now, size: 10},
+		"c.json": {modTime: now, size: 10},
+	}
+	current := map[string]fileState{
+		"a.json": {modTime: now, size: 10},
+		"b.json": {modTime: now.Add(time.Second), size: 10},
+		"d.json": {modTime: now, size: 5},
+	}
+
+	expected := []Event{
+		{Name: "b.json", Op: Write},
+		{Name: "c.json", Op: Remove},
+		{Name: "d.json", Op: Create},
+	}
+
+	got := diff(previous, current)
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected event %d to be %v, got %v", i, expected[i], got[i])
+		}
+	}
+}
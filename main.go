@@ -4,14 +4,20 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"runtime/debug"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/RAshkettle/getter/internal/files"
+	"github.com/RAshkettle/getter/internal/ids"
+	"github.com/RAshkettle/getter/internal/store"
+	"github.com/RAshkettle/getter/internal/watch"
 )
 
 // application represents the main application instance with its configuration.
@@ -19,32 +25,83 @@ import (
 type application struct {
 	logger   *slog.Logger
 	dataPath string
+
+	// allowCollectionDelete enables DELETE /{filename} for whole collections.
+	allowCollectionDelete bool
+
+	// idGenerators holds the id generation strategy for each collection,
+	// keyed by collection name; the "" key holds the default strategy.
+	idGenerators map[string]ids.Generator
+
+	// relations are the relations between collections declared with
+	// -relation; others are inferred from field names.
+	relations []relation
+
+	// store holds the collections of the data directory in memory.
+	store *store.Store
 }
 
 // main is the entry point of the application.
 // It validates command-line arguments, initializes the application,
 // and starts the main execution flow.
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: getter <folder>  Example:  getter '~/tempData'")
+	allowCollectionDelete := flag.Bool("allow-collection-delete", false, "allow DELETE /{filename} to empty or remove whole collections")
+	watchFiles := flag.Bool("watch", true, "reload collections when their data files change")
+	pollInterval := flag.Duration("poll-interval", 0, "watch the data folder by polling at this `interval` instead of using inotify")
+	idStrategies := collectionSettings{}
+	flag.Var(idStrategies, "id-strategy", "id `strategy` for new records: auto, increment, uuid4, uuid7, ulid, prefix:<prefix>[:<digits>] or template:<template>; use <collection>=<strategy> to set it for one collection (repeatable)")
+	idFields := collectionSettings{}
+	flag.Var(idFields, "id-field", "`field` identifying records instead of id, or comma-separated fields forming a composite key; use <collection>=<field> to set it for one collection (repeatable)")
+	relationSettings := collectionSettings{}
+	flag.Var(relationSettings, "relation", "declare that `<child>.<field>=<parent>` holds the id of a record in the parent collection, for _expand and _embed (repeatable)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: getter [flags] <folder>  Example:  getter '~/tempData'")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
 	// Determine if the datapath is a valid directory
-	dataPath, err := getDataPath(os.Args[1])
+	dataPath, err := getDataPath(flag.Arg(0))
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	idGenerators, err := parseIDStrategies(idStrategies)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	relations, err := parseRelations(relationSettings)
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
 
+	dataStore := store.New(dataPath)
+	if err := setIDFields(dataStore, idFields); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
 	// Load the port from environment variables or .env file
 	port := getPort()
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
 	app := &application{
-		logger:   logger,
-		dataPath: dataPath,
+		logger:                logger,
+		dataPath:              dataPath,
+		store:                 dataStore,
+		allowCollectionDelete: *allowCollectionDelete,
+		idGenerators:          idGenerators,
+		relations:             relations,
 	}
 	srv := &http.Server{
 		Addr:         port,
@@ -52,7 +109,17 @@ func main() {
 		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: 10 * time.Second, // lifted for streamed responses; see streamRecords
+	}
+
+	if *watchFiles {
+		watcher, err := newWatcher(dataPath, *pollInterval)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		app.logger.Info("Watching data folder", "mode", watcher.Mode())
+		go app.watchData(watcher)
 	}
 
 	app.logger.Info("Initialized application", "dataPath", app.dataPath, "port", srv.Addr)
@@ -62,7 +129,7 @@ func main() {
 }
 
 // serverError handles internal server errors by logging detailed error information
-// and returning a generic 500 Internal Server Error response to the client.
+// and returning a generic 500 Internal Server Error problem response to the client.
 // This function logs the original error, HTTP method, URI, and a stack trace to aid debugging,
 // while preventing sensitive error details from being exposed to clients.
 //
@@ -78,7 +145,7 @@ func (app *application) serverError(w http.ResponseWriter, r *http.Request, err
 	)
 
 	app.logger.Error(err.Error(), "method", method, "uri", uri, "trace", trace)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	writeProblem(w, r, http.StatusInternalServerError, "The server could not process the request")
 }
 
 // getDataPath processes and validates a data path string.
@@ -104,3 +171,97 @@ func getDataPath(dataPath string) (string, error) {
 	}
 	return dataPath, nil
 }
+
+// collectionSettings is a command-line flag holding a setting per collection.
+// Each use of the flag is either "<collection>=<value>", which applies to one
+// collection, or a bare "<value>", which becomes the default for all
+// collections and is stored under the "" key.
+type collectionSettings map[string]string
+
+// String returns the settings in the same form they are given on the command line.
+func (s collectionSettings) String() string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := make([]string, 0, len(s))
+	for _, key := range keys {
+		if key == "" {
+			values = append(values, s[key])
+		} else {
+			values = append(values, key+"="+s[key])
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+// Set records one use of the flag.
+func (s collectionSettings) Set(value string) error {
+	collection, setting, found := strings.Cut(value, "=")
+	if !found {
+		collection, setting = "", value
+	}
+	s[files.TrimDataExtension(collection)] = setting
+	return nil
+}
+
+// newWatcher starts watching the data folder, polling at the given interval
+// if it is set and using the platform's native notifications otherwise.
+//
+// Parameters:
+//   - dataPath: The data folder to watch
+//   - pollInterval: The polling interval, or 0 to use native notifications
+//
+// Returns:
+//   - *watch.Watcher: The running watcher
+//   - error: An error if the folder can't be watched
+func newWatcher(dataPath string, pollInterval time.Duration) (*watch.Watcher, error) {
+	if pollInterval > 0 {
+		return watch.NewPolling(dataPath, pollInterval)
+	}
+	return watch.New(dataPath)
+}
+
+// parseIDStrategies converts the -id-strategy settings into id generators.
+//
+// Parameters:
+//   - strategies: The id strategy specification for each collection
+//
+// Returns:
+//   - map[string]ids.Generator: The generator for each collection
+//   - error: An error if any of the strategies is invalid
+func parseIDStrategies(strategies collectionSettings) (map[string]ids.Generator, error) {
+	generators := make(map[string]ids.Generator, len(strategies))
+	for collection, spec := range strategies {
+		generator, err := ids.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		generators[collection] = generator
+	}
+	return generators, nil
+}
+
+// setIDFields applies the -id-field settings to the store. Each setting is a
+// field name, or comma-separated field names forming a composite key.
+//
+// Parameters:
+//   - s: The store to configure
+//   - settings: The id fields for each collection
+//
+// Returns:
+//   - error: An error if a setting is invalid
+func setIDFields(s *store.Store, settings collectionSettings) error {
+	for collection, spec := range settings {
+		fields := strings.Split(spec, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if err := s.SetIDFields(collection, fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
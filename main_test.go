@@ -248,3 +248,26 @@ func randString(n int) string {
 	}
 	return string(b)
 }
+
+// TestCollectionSettings tests parsing of per-collection command-line settings
+func TestCollectionSettings(t *testing.T) {
+	settings := collectionSettings{}
+	for _, value := range []string{"uuid4", "customers=prefix:CUST-", "orders.json=template:ORD-{seq:4}"} {
+		if err := settings.Set(value); err != nil {
+			t.Fatalf("Set(%q) error = %v", value, err)
+		}
+	}
+
+	expected := "uuid4,customers=prefix:CUST-,orders=template:ORD-{seq:4}"
+	if got := settings.String(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	if _, err := parseIDStrategies(settings); err != nil {
+		t.Errorf("Expected valid strategies, got error: %v", err)
+	}
+
+	if _, err := parseIDStrategies(collectionSettings{"": "sequential"}); err == nil {
+		t.Error("Expected an error for an unknown strategy")
+	}
+}
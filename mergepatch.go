@@ -0,0 +1,40 @@
+package main
+
+// mergePatch applies a JSON Merge Patch (RFC 7396) to target and returns the
+// result. If the patch is an object, each of its members is merged into the
+// target: null values remove the member, objects are merged recursively and any
+// other value replaces the member. A patch that is not an object replaces the
+// target entirely.
+//
+// The target is not modified; objects along the patched paths are copied.
+//
+// Parameters:
+//   - target: The decoded JSON value to patch
+//   - patch: The decoded JSON merge patch document
+//
+// Returns:
+//   - interface{}: The patched value
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	result := make(map[string]interface{}, len(targetObject)+len(patchObject))
+	if ok {
+		for key, value := range targetObject {
+			result[key] = value
+		}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		result[key] = mergePatch(result[key], value)
+	}
+
+	return result
+}
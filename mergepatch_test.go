@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestMergePatch tests mergePatch against the examples in RFC 7396 Appendix A
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target   string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target+" + "+tt.patch, func(t *testing.T) {
+			got := mergePatch(mustDecode(t, tt.target), mustDecode(t, tt.patch))
+			expected := mustDecode(t, tt.expected)
+
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("mergePatch() = %v, want %v", got, expected)
+			}
+		})
+	}
+}
+
+// TestMergePatchDoesNotModifyTarget tests that nested objects in the target are copied
+func TestMergePatchDoesNotModifyTarget(t *testing.T) {
+	target := mustDecode(t, `{"address":{"city":"Portland","state":"OR"}}`)
+
+	mergePatch(target, mustDecode(t, `{"address":{"city":"Salem"}}`))
+
+	city := target.(map[string]interface{})["address"].(map[string]interface{})["city"]
+	if city != "Portland" {
+		t.Errorf("Expected target to be unchanged, city is %v", city)
+	}
+}
+
+// mustDecode decodes a JSON string and fails the test if it is invalid
+func mustDecode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("Failed to decode %s: %v", s, err)
+	}
+	return v
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 // commonHeaders is a middleware that sets common security headers for all HTTP responses.
@@ -95,3 +97,50 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// subCollections is a middleware that routes requests for the arrays of a data
+// file holding several of them. When the first two segments of the path name
+// a file and one of its arrays, as in /store/products/5, they are joined into
+// the single segment store%2Fproducts so the standard routes treat them as one
+// collection name, "store/products". Other requests pass through unchanged.
+//
+// Parameters:
+//   - next: The next handler in the middleware chain to be called after this middleware
+//
+// Returns:
+//   - http.Handler: A handler that rewrites sub-collection paths and then calls the next handler
+func (app *application) subCollections(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		segments := strings.SplitN(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/", 3)
+		if len(segments) < 2 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		file, err1 := url.PathUnescape(segments[0])
+		key, err2 := url.PathUnescape(segments[1])
+		if err1 != nil || err2 != nil || key == "" || strings.Contains(file, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		coll, err := app.store.Collection(file)
+		if err != nil || !coll.HasArray(key) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Rewrite a copy of the request, as http.StripPrefix does
+		escaped := "/" + segments[0] + "%2F" + segments[1]
+		if len(segments) == 3 {
+			escaped += "/" + segments[2]
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.RawPath = escaped
+		r2.URL.Path, _ = url.PathUnescape(escaped)
+		next.ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// errPointerNotFound is returned when a JSON Pointer doesn't refer to an
+// existing value, or to a place where a value can be added.
+var errPointerNotFound = errors.New("path not found")
+
+// parsePointer splits the sub-path of a record URL, such as "address/city",
+// into the reference tokens of the JSON Pointer (RFC 6901) "/address/city".
+// "~1" and "~0" in a segment stand for "/" and "~".
+//
+// Parameters:
+//   - path: The URL path after the record id, without a leading slash
+//
+// Returns:
+//   - []string: The unescaped reference tokens
+func parsePointer(path string) []string {
+	tokens := strings.Split(path, "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens
+}
+
+// pointerGet returns the value a JSON Pointer refers to. Objects are indexed
+// by member name and arrays by a decimal index.
+//
+// Parameters:
+//   - doc: The decoded JSON document
+//   - tokens: The reference tokens of the pointer
+//
+// Returns:
+//   - interface{}: The value
+//   - bool: True if the value exists
+func pointerGet(doc interface{}, tokens []string) (interface{}, bool) {
+	for _, token := range tokens {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			value, ok := v[token]
+			if !ok {
+				return nil, false
+			}
+			doc = value
+		case []interface{}:
+			i, ok := arrayIndex(token, len(v))
+			if !ok {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// pointerSet returns a copy of doc with the value a JSON Pointer refers to
+// replaced by value. Like the JSON Patch "add" operation, a missing member of
+// an existing object is created and the token "-" appends to an array, but
+// the parent of the value must exist. doc itself is not modified; objects and
+// arrays along the path are copied.
+//
+// Parameters:
+//   - doc: The decoded JSON document
+//   - tokens: The reference tokens of the pointer
+//   - value: The new value
+//
+// Returns:
+//   - interface{}: The updated document
+//   - error: errPointerNotFound if the parent of the value doesn't exist
+func pointerSet(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		child, ok := v[tokens[0]]
+		if !ok && len(tokens) > 1 {
+			return nil, errPointerNotFound
+		}
+		updated, err := pointerSet(child, tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		copied := make(map[string]interface{}, len(v)+1)
+		for key, member := range v {
+			copied[key] = member
+		}
+		copied[tokens[0]] = updated
+		return copied, nil
+
+	case []interface{}:
+		if tokens[0] == "-" && len(tokens) == 1 {
+			return append(v[:len(v):len(v)], value), nil
+		}
+		i, ok := arrayIndex(tokens[0], len(v))
+		if !ok {
+			return nil, errPointerNotFound
+		}
+		updated, err := pointerSet(v[i], tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		copied := append([]interface{}(nil), v...)
+		copied[i] = updated
+		return copied, nil
+	}
+	return nil, errPointerNotFound
+}
+
+// pointerRemove returns a copy of doc without the value a JSON Pointer refers
+// to. Removing an array element shifts the following elements down. doc
+// itself is not modified.
+//
+// Parameters:
+//   - doc: The decoded JSON document
+//   - tokens: The reference tokens of the pointer; there must be at least one
+//
+// Returns:
+//   - interface{}: The updated document
+//   - error: errPointerNotFound if the value doesn't exist
+func pointerRemove(doc interface{}, tokens []string) (interface{}, error) {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		child, ok := v[tokens[0]]
+		if !ok {
+			return nil, errPointerNotFound
+		}
+		copied := make(map[string]interface{}, len(v))
+		for key, member := range v {
+			copied[key] = member
+		}
+		if len(tokens) == 1 {
+			delete(copied, tokens[0])
+			return copied, nil
+		}
+		updated, err := pointerRemove(child, tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		copied[tokens[0]] = updated
+		return copied, nil
+
+	case []interface{}:
+		i, ok := arrayIndex(tokens[0], len(v))
+		if !ok {
+			return nil, errPointerNotFound
+		}
+		if len(tokens) == 1 {
+			return append(v[:i:i], v[i+1:]...), nil
+		}
+		updated, err := pointerRemove(v[i], tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		copied := append([]interface{}(nil), v...)
+		copied[i] = updated
+		return copied, nil
+	}
+	return nil, errPointerNotFound
+}
+
+// arrayIndex parses an array index token, which must be a decimal number
+// without leading zeros that is within the array's bounds.
+func arrayIndex(token string, length int) (int, bool) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, false
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i >= length || token[0] == '+' {
+		return 0, false
+	}
+	return i, true
+}
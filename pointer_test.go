@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testPointerDoc is the document used by the JSON Pointer tests
+const testPointerDoc = `{"address":{"city":"Portland","lines":["1 Main St","Apt 2"]},"a/b":1,"m~n":2,"":3}`
+
+// TestPointerGet tests resolving JSON Pointers, including the RFC 6901 escapes
+func TestPointerGet(t *testing.T) {
+	doc := mustDecode(t, testPointerDoc)
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "address/city", expected: `"Portland"`},
+		{path: "address/lines/1", expected: `"Apt 2"`},
+		{path: "address", expected: `{"city":"Portland","lines":["1 Main St","Apt 2"]}`},
+		{path: "a~1b", expected: `1`},
+		{path: "m~0n", expected: `2`},
+		{path: "", expected: `3`},
+		{path: "address/zip"},
+		{path: "address/lines/2"},
+		{path: "address/lines/01"},
+		{path: "address/lines/-"},
+		{path: "address/city/0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			value, ok := pointerGet(doc, parsePointer(tt.path))
+			if tt.expected == "" {
+				if ok {
+					t.Errorf("Expected no value, got %v", value)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("Expected a value")
+			}
+			if !reflect.DeepEqual(value, mustDecode(t, tt.expected)) {
+				t.Errorf("Expected %s, got %v", tt.expected, value)
+			}
+		})
+	}
+}
+
+// TestPointerSetAndRemove tests changing documents through JSON Pointers
+// without modifying the original
+func TestPointerSetAndRemove(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		value    string
+		remove   bool
+		expected string
+	}{
+		{name: "Replace member", path: "address/city", value: `"Salem"`, expected: `{"address":{"city":"Salem","lines":["1 Main St","Apt 2"]}}`},
+		{name: "Add member", path: "address/zip", value: `"97201"`, expected: `{"address":{"city":"Portland","lines":["1 Main St","Apt 2"],"zip":"97201"}}`},
+		{name: "Replace element", path: "address/lines/0", value: `"2 Main St"`, expected: `{"address":{"city":"Portland","lines":["2 Main St","Apt 2"]}}`},
+		{name: "Append element", path: "address/lines/-", value: `"Floor 3"`, expected: `{"address":{"city":"Portland","lines":["1 Main St","Apt 2","Floor 3"]}}`},
+		{name: "Missing parent", path: "phone/home", value: `"555"`},
+		{name: "Index out of range", path: "address/lines/5", value: `"x"`},
+		{name: "Remove member", path: "address/city", remove: true, expected: `{"address":{"lines":["1 Main St","Apt 2"]}}`},
+		{name: "Remove element", path: "address/lines/0", remove: true, expected: `{"address":{"city":"Portland","lines":["Apt 2"]}}`},
+		{name: "Remove missing", path: "address/zip", remove: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := `{"address":{"city":"Portland","lines":["1 Main St","Apt 2"]}}`
+			doc := mustDecode(t, original)
+
+			var got interface{}
+			var err error
+			if tt.remove {
+				got, err = pointerRemove(doc, parsePointer(tt.path))
+			} else {
+				got, err = pointerSet(doc, parsePointer(tt.path), mustDecode(t, tt.value))
+			}
+
+			if tt.expected == "" {
+				if !errors.Is(err, errPointerNotFound) {
+					t.Errorf("Expected errPointerNotFound, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			} else if !reflect.DeepEqual(got, mustDecode(t, tt.expected)) {
+				encoded, _ := json.Marshal(got)
+				t.Errorf("Expected %s, got %s", tt.expected, encoded)
+			}
+
+			if encoded, _ := json.Marshal(doc); string(encoded) != original {
+				t.Errorf("Document was modified: %s", encoded)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/RAshkettle/getter/internal/store"
+)
+
+// problemContentType is the media type of error responses (RFC 7807).
+const problemContentType = "application/problem+json"
+
+// problem is the body of an error response, an RFC 7807 problem details
+// object. Problems use the type "about:blank", so the status code alone
+// identifies the kind of error and the title is its standard reason phrase.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance"`
+}
+
+// writeProblem sends an application/problem+json error response. The
+// instance member is the request URI, which identifies the failed request.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - status: The HTTP status code to send
+//   - detail: A human-readable explanation of this occurrence of the error
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	// Encoding strings and numbers can't fail
+	content, _ := store.EncodeJSON(problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.RequestURI(),
+	})
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+// clientError responds to a request that can't be served as asked, such as
+// one with a malformed query string or for a record that doesn't exist.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - status: The 4xx HTTP status code to send
+//   - detail: A human-readable explanation of the error
+func (app *application) clientError(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	writeProblem(w, r, status, detail)
+}
+
+// collectionError responds to an error loading or changing a collection.
+// Unknown collections are reported with a 404 Not Found; anything else is a
+// server error.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - name: The requested collection
+//   - err: The error returned by the store
+func (app *application) collectionError(w http.ResponseWriter, r *http.Request, name string, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		app.clientError(w, r, http.StatusNotFound, fmt.Sprintf("Collection %s not found", name))
+		return
+	}
+	app.serverError(w, r, err)
+}
+
+// unmatchedRoutes answers requests that match none of the routes of mux with
+// a problem response: a 404 Not Found for unknown paths, or a 405 Method Not
+// Allowed with an Allow header listing the methods the path supports, the
+// same list OPTIONS requests get from allowedMethods.
+//
+// Parameters:
+//   - mux: The router whose routes are served
+//
+// Returns:
+//   - http.Handler: A handler serving mux with problem responses for unmatched requests
+func (app *application) unmatchedRoutes(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// Let the router's own handler tell unknown paths from unsupported
+		// methods, and replace its plain text body
+		rec := &statusRecorder{header: make(http.Header)}
+		h.ServeHTTP(rec, r)
+		if rec.status < http.StatusBadRequest {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		detail := fmt.Sprintf("No route for %s", r.URL.Path)
+		if rec.status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", app.allowedMethods(r))
+			detail = fmt.Sprintf("Method %s is not allowed for %s", r.Method, r.URL.Path)
+		}
+		writeProblem(w, r, rec.status, detail)
+	})
+}
+
+// statusRecorder is a response writer that keeps the headers and status code
+// written to it and discards the body.
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+// Header returns the recorded headers.
+func (rec *statusRecorder) Header() http.Header {
+	return rec.header
+}
+
+// Write discards the body.
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+// WriteHeader records the status code.
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
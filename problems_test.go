@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestProblemResponses tests that errors are answered with the right status
+// code and an RFC 7807 problem body
+func TestProblemResponses(t *testing.T) {
+	app := newTestApp(t, map[string]string{"customers.json": testCustomers})
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		status int
+		allow  string
+		detail string
+	}{
+		{name: "Unknown collection", method: http.MethodGet, url: "/orders", status: http.StatusNotFound, detail: "Collection orders not found"},
+		{name: "Unknown collection with id", method: http.MethodGet, url: "/orders/1", status: http.StatusNotFound, detail: "Collection orders not found"},
+		{name: "Post to unknown collection", method: http.MethodPost, url: "/orders", body: `{}`, status: http.StatusNotFound, detail: "Collection orders not found"},
+		{name: "Unknown record", method: http.MethodGet, url: "/customers/CUST-1", status: http.StatusNotFound, detail: "Record with ID CUST-1 not found"},
+		{name: "Unknown route", method: http.MethodGet, url: "/customers/", status: http.StatusNotFound, detail: "No route for /customers/"},
+		{name: "Unsupported method", method: http.MethodPost, url: "/customers/CUST-10058429", body: `{}`, status: http.StatusMethodNotAllowed, allow: "GET, HEAD, PUT, PATCH, DELETE, OPTIONS", detail: "Method POST is not allowed for /customers/CUST-10058429"},
+		{name: "Disabled collection delete", method: http.MethodDelete, url: "/customers", status: http.StatusMethodNotAllowed, allow: "GET, HEAD, POST, OPTIONS", detail: "Deleting collections is disabled"},
+		{name: "Bad filter", method: http.MethodGet, url: "/customers?name_regex=(", status: http.StatusBadRequest},
+		{name: "Bad body", method: http.MethodPost, url: "/customers", body: `[1]`, status: http.StatusBadRequest, detail: "Request body must be a JSON object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != problemContentType {
+				t.Errorf("Expected Content-Type %s, got %s", problemContentType, contentType)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.allow {
+				t.Errorf("Expected Allow header %q, got %q", tt.allow, allow)
+			}
+
+			var got problem
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Failed to parse problem: %v", err)
+			}
+			expected := problem{
+				Type:     "about:blank",
+				Title:    http.StatusText(tt.status),
+				Status:   tt.status,
+				Detail:   got.Detail,
+				Instance: tt.url,
+			}
+			if tt.detail != "" {
+				expected.Detail = tt.detail
+			}
+			if got != expected || got.Detail == "" {
+				t.Errorf("Expected problem %+v, got %+v", expected, got)
+			}
+		})
+	}
+}
+
+// TestAllowMatchesOptions tests that 405 responses list the same methods as
+// OPTIONS requests for the same path
+func TestAllowMatchesOptions(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"customers.json": testCustomers,
+		"settings.json":  `{"theme": "dark"}`,
+		"store.json":     `{"products": [{"id": 1}], "categories": []}`,
+	})
+
+	tests := []struct {
+		name   string
+		url    string
+		method string
+		allow  string
+	}{
+		{name: "Home", url: "/", method: http.MethodPost, allow: "GET, HEAD, OPTIONS"},
+		{name: "Collection", url: "/customers", method: http.MethodPut, allow: "GET, HEAD, POST, OPTIONS"},
+		{name: "Record", url: "/customers/CUST-10058429", method: http.MethodPost, allow: "GET, HEAD, PUT, PATCH, DELETE, OPTIONS"},
+		{name: "Child collection", url: "/customers/CUST-10058429/orders", method: http.MethodTrace, allow: "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"},
+		{name: "Path inside a record", url: "/customers/CUST-10058429/address/city", method: http.MethodPost, allow: "GET, HEAD, PUT, PATCH, DELETE, OPTIONS"},
+		{name: "Singleton", url: "/settings", method: http.MethodPost, allow: "GET, HEAD, PUT, PATCH, OPTIONS"},
+		{name: "Sub-collection", url: "/store/products", method: http.MethodPatch, allow: "GET, HEAD, POST, OPTIONS"},
+		{name: "Sub-collection record", url: "/store/products/1", method: http.MethodPost, allow: "GET, HEAD, PUT, PATCH, DELETE, OPTIONS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodOptions, tt.url, nil))
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("Expected status code %d for OPTIONS, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.allow {
+				t.Errorf("Expected OPTIONS Allow header %q, got %q", tt.allow, allow)
+			}
+
+			w = httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(`{}`)))
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("Expected status code %d for %s, got %d: %s", http.StatusMethodNotAllowed, tt.method, w.Code, w.Body.String())
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.allow {
+				t.Errorf("Expected %s Allow header %q, got %q", tt.method, tt.allow, allow)
+			}
+		})
+	}
+}
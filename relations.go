@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/RAshkettle/getter/internal/files"
+	"github.com/RAshkettle/getter/internal/store"
+)
+
+// errUnknownRelation is returned when _expand or _embed names a relation that
+// can't be resolved.
+var errUnknownRelation = errors.New("unknown relation")
+
+// relation links the records of a child collection to a parent collection
+// through a foreign key field holding the parent's id, e.g. orders.customerId
+// referring to customers.
+type relation struct {
+	child  string
+	field  string
+	parent string
+}
+
+// parseRelations converts the -relation settings into relations. Each setting
+// has the form "<child>.<field>=<parent>", for example "orders.buyer=customers".
+//
+// Parameters:
+//   - settings: The declared relations
+//
+// Returns:
+//   - []relation: The relations
+//   - error: An error if a setting is malformed
+func parseRelations(settings collectionSettings) ([]relation, error) {
+	relations := make([]relation, 0, len(settings))
+	for key, parent := range settings {
+		child, field, found := strings.Cut(key, ".")
+		parent = files.TrimDataExtension(parent)
+		if !found || child == "" || field == "" || parent == "" {
+			return nil, fmt.Errorf("invalid relation %q, expected <child>.<field>=<parent>", key+"="+parent)
+		}
+		relations = append(relations, relation{child: child, field: field, parent: parent})
+	}
+	return relations, nil
+}
+
+// expandRelation resolves _expand=name on the child collection. A declared
+// relation whose parent is name, or its plural, is used if there is one;
+// otherwise the relation is inferred from a "<name>Id" field referring to the
+// collection "<name>s" (or "<name>").
+func (app *application) expandRelation(child, name string) (relation, error) {
+	for _, r := range app.relations {
+		if r.child == child && (r.parent == name || singular(r.parent) == name) {
+			return r, nil
+		}
+	}
+
+	for _, parent := range []string{plural(name), name} {
+		if app.collectionExists(parent) {
+			return relation{child: child, field: name + "Id", parent: parent}, nil
+		}
+	}
+	return relation{}, fmt.Errorf("%w: no collection for _expand=%s", errUnknownRelation, name)
+}
+
+// embedRelation resolves _embed=name on the parent collection: name is the
+// child collection, whose records refer to the parent through a declared
+// relation or a "<singular parent>Id" field.
+func (app *application) embedRelation(parent, name string) (relation, error) {
+	if !app.collectionExists(name) {
+		return relation{}, fmt.Errorf("%w: no collection for _embed=%s", errUnknownRelation, name)
+	}
+
+	for _, r := range app.relations {
+		if r.child == name && r.parent == parent {
+			return r, nil
+		}
+	}
+	return relation{child: name, field: singular(parent) + "Id", parent: parent}, nil
+}
+
+// collectionExists reports whether a collection can be loaded from the data folder.
+func (app *application) collectionExists(name string) bool {
+	_, err := app.store.Collection(name)
+	return err == nil
+}
+
+// relationExpander builds the function that inlines the related records
+// requested by the _expand and _embed parameters. _expand=customer sets the
+// customer field of each record to the customer its customerId refers to;
+// _embed=orders sets the orders field to the array of orders referring to
+// the record. Both take comma-separated lists and may be repeated.
+//
+// Parameters:
+//   - coll: The collection the records belong to
+//   - values: The parsed query string
+//
+// Returns:
+//   - func: Returns copies of records with the related records added, or nil if
+//     no relations were requested
+//   - error: An error wrapping errUnknownRelation if a relation can't be
+//     resolved, or an error if a related collection can't be loaded
+func (app *application) relationExpander(coll *store.Collection, values url.Values) (func([]map[string]interface{}) []map[string]interface{}, error) {
+	type link struct {
+		name     string
+		relation relation
+		embed    bool
+	}
+
+	var links []link
+	for _, param := range []string{"_expand", "_embed"} {
+		for _, v := range values[param] {
+			for _, name := range strings.Split(v, ",") {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					return nil, fmt.Errorf("%w: empty name in %s", errUnknownRelation, param)
+				}
+
+				var r relation
+				var err error
+				if param == "_embed" {
+					r, err = app.embedRelation(coll.Name(), name)
+				} else {
+					r, err = app.expandRelation(coll.Name(), name)
+				}
+				if err != nil {
+					return nil, err
+				}
+				links = append(links, link{name: name, relation: r, embed: param == "_embed"})
+			}
+		}
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	return func(records []map[string]interface{}) []map[string]interface{} {
+		expanded := make([]map[string]interface{}, len(records))
+		for i, record := range records {
+			expanded[i] = make(map[string]interface{}, len(record)+len(links))
+			for k, v := range record {
+				expanded[i][k] = v
+			}
+		}
+
+		for _, l := range links {
+			if l.embed {
+				app.embedRecords(expanded, l.name, l.relation)
+			} else {
+				app.expandRecords(expanded, l.name, l.relation)
+			}
+		}
+		return expanded
+	}, nil
+}
+
+// expandRecords sets the name field of each record to the parent record its
+// foreign key refers to. Records without a matching parent are left alone.
+func (app *application) expandRecords(records []map[string]interface{}, name string, r relation) {
+	parents, err := app.store.Collection(r.parent)
+	if err != nil {
+		return
+	}
+	for _, record := range records {
+		key, ok := record[r.field]
+		if !ok || key == nil {
+			continue
+		}
+		if parent, ok := parents.Get(fmt.Sprintf("%v", key)); ok {
+			record[name] = parent
+		}
+	}
+}
+
+// embedRecords sets the name field of each record to the array of child
+// records whose foreign key refers to it.
+func (app *application) embedRecords(records []map[string]interface{}, name string, r relation) {
+	children := make(map[string][]interface{})
+	if coll, err := app.store.Collection(r.child); err == nil {
+		for _, child := range coll.Records() {
+			if key, ok := child[r.field]; ok && key != nil {
+				id := fmt.Sprintf("%v", key)
+				children[id] = append(children[id], child)
+			}
+		}
+	}
+
+	parents, err := app.store.Collection(r.parent)
+	if err != nil {
+		return
+	}
+	for _, record := range records {
+		embedded := children[parents.RecordID(record)]
+		if embedded == nil {
+			embedded = []interface{}{}
+		}
+		record[name] = embedded
+	}
+}
+
+// singular returns the singular form of an English collection name, e.g.
+// "customers" becomes "customer" and "categories" becomes "category".
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"),
+		strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+// plural returns the plural form of an English singular noun, e.g.
+// "customer" becomes "customers" and "category" becomes "categories".
+func plural(name string) string {
+	switch {
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsAny(name[len(name)-2:len(name)-1], "aeiou"):
+		return name[:len(name)-1] + "ies"
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"),
+		strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	}
+	return name + "s"
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testOrders is the content of the orders.json file used by the relation tests
+const testOrders = `{
+  "orders": [
+    {"id": 7, "customerId": "CUST-10058429", "total": 42.5},
+    {"id": 8, "customerId": "CUST-10058429", "total": 10},
+    {"id": 9, "customerId": "CUST-00000000", "total": 3}
+  ]
+}`
+
+// TestRelations tests inlining related records with _expand and _embed
+func TestRelations(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"customers.json": testCustomers,
+		"orders.json":    testOrders,
+		"products.json":  testProducts,
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		status   int
+		expected string
+	}{
+		{
+			name:     "Expand",
+			url:      "/orders/7?_expand=customer&_fields=id,customer.firstName",
+			status:   http.StatusOK,
+			expected: `{"customer":{"firstName":"Emily"},"id":7}`,
+		},
+		{
+			name:     "Expand without a match",
+			url:      "/orders?id=9&_expand=customer",
+			status:   http.StatusOK,
+			expected: `{"orders":[{"customerId":"CUST-00000000","id":9,"total":3}]}`,
+		},
+		{
+			name:     "Embed",
+			url:      "/customers/CUST-10058429?_embed=orders&_fields=id,orders",
+			status:   http.StatusOK,
+			expected: `{"id":"CUST-10058429","orders":[{"customerId":"CUST-10058429","id":7,"total":42.5},{"customerId":"CUST-10058429","id":8,"total":10}]}`,
+		},
+		{
+			name:     "Embed on a collection",
+			url:      "/customers?_embed=orders&_exclude=orders.customerId,address,firstName",
+			status:   http.StatusOK,
+			expected: `{"customers":[{"id":"CUST-10058429","orders":[{"customerId":"CUST-10058429","id":7,"total":42.5},{"customerId":"CUST-10058429","id":8,"total":10}]}]}`,
+		},
+		{
+			name:     "Embed without children",
+			url:      "/products/1?_embed=orders&_fields=id,orders",
+			status:   http.StatusOK,
+			expected: `{"id":1,"orders":[]}`,
+		},
+		{name: "Unknown expand", url: "/orders?_expand=warehouse", status: http.StatusBadRequest},
+		{name: "Unknown embed", url: "/customers/CUST-10058429?_embed=invoices", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.expected == "" {
+				return
+			}
+
+			var got bytes.Buffer
+			if err := json.Compact(&got, w.Body.Bytes()); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if got.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got.String())
+			}
+		})
+	}
+}
+
+// TestDeclaredRelations tests relations given with -relation that don't follow
+// the <singular>Id naming convention
+func TestDeclaredRelations(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"customers.json": testCustomers,
+		"orders.json":    `{"orders": [{"id": 1, "buyer": "CUST-10058429"}]}`,
+	})
+
+	relations, err := parseRelations(collectionSettings{"orders.buyer": "customers.json"})
+	if err != nil {
+		t.Fatalf("parseRelations() error = %v", err)
+	}
+	app.relations = relations
+
+	for url, expected := range map[string]string{
+		"/orders/1?_expand=customer&_fields=customer.id":        `{"customer":{"id":"CUST-10058429"}}`,
+		"/customers/CUST-10058429?_embed=orders&_fields=orders": `{"orders":[{"buyer":"CUST-10058429","id":1}]}`,
+	} {
+		w := httptest.NewRecorder()
+		app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+
+		var got bytes.Buffer
+		json.Compact(&got, w.Body.Bytes())
+		if got.String() != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, url, got.String())
+		}
+	}
+
+	for _, setting := range []string{"orders", "orders.", ".buyer"} {
+		if _, err := parseRelations(collectionSettings{setting: "customers"}); err == nil {
+			t.Errorf("Expected an error for -relation %s=customers", setting)
+		}
+	}
+}
+
+// TestSingularPlural tests converting between singular and plural collection names
+func TestSingularPlural(t *testing.T) {
+	for one, many := range map[string]string{
+		"customer": "customers",
+		"category": "categories",
+		"day":      "days",
+		"address":  "addresses",
+		"box":      "boxes",
+		"match":    "matches",
+	} {
+		if got := plural(one); got != many {
+			t.Errorf("plural(%q) = %q, expected %q", one, got, many)
+		}
+		if got := singular(many); got != one {
+			t.Errorf("singular(%q) = %q, expected %q", many, got, one)
+		}
+	}
+}
+
+// TestNestedRoutes tests reading and adding child records under a parent record
+func TestNestedRoutes(t *testing.T) {
+	app := newTestApp(t, map[string]string{
+		"customers.json": testCustomers,
+		"orders.json":    testOrders,
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		status   int
+		expected string
+	}{
+		{
+			name:     "List children",
+			method:   http.MethodGet,
+			url:      "/customers/CUST-10058429/orders?_fields=id",
+			status:   http.StatusOK,
+			expected: `{"orders":[{"id":7},{"id":8}]}`,
+		},
+		{
+			name:     "Query children",
+			method:   http.MethodGet,
+			url:      "/customers/CUST-10058429/orders?total_gt=20",
+			status:   http.StatusOK,
+			expected: `{"orders":[{"customerId":"CUST-10058429","id":7,"total":42.5}]}`,
+		},
+		{
+			name:     "Create child",
+			method:   http.MethodPost,
+			url:      "/customers/CUST-10058429/orders",
+			body:     `{"total": 5}`,
+			status:   http.StatusCreated,
+			expected: `{"customerId":"CUST-10058429","id":10,"total":5}`,
+		},
+		{name: "Conflicting foreign key", method: http.MethodPost, url: "/customers/CUST-10058429/orders", body: `{"customerId": "CUST-1"}`, status: http.StatusBadRequest},
+		{name: "Unknown parent", method: http.MethodGet, url: "/customers/CUST-1/orders", status: http.StatusNotFound},
+		{name: "Unknown child collection", method: http.MethodPost, url: "/customers/CUST-10058429/invoices", body: `{}`, status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.expected == "" {
+				return
+			}
+
+			var got bytes.Buffer
+			if err := json.Compact(&got, w.Body.Bytes()); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if got.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got.String())
+			}
+		})
+	}
+
+	// The new order is stored and listed under its customer
+	if records := readTestRecords(t, app, "orders.json", "orders"); len(records) != 4 || records[3]["customerId"] != "CUST-10058429" {
+		t.Errorf("Expected the new order to be stored with its customer, got %v", records)
+	}
+}
@@ -9,11 +9,29 @@ import (
 // routes configures and returns the application's HTTP request router.
 // It sets up all request routes and applies the standard middleware chain
 // which includes panic recovery, request logging, and common headers.
+// In every route, {filename} may also be a file and one of its arrays, such as
+// store/products; see subCollections.
+//
+// Requests that match no route are answered with a 404 Not Found, or a 405
+// Method Not Allowed listing the supported methods; see unmatchedRoutes.
 //
 // Routes defined:
 //   - GET / : Home page that lists all available data files
 //   - GET /{filename} : Returns all records from the specified JSON file
 //   - GET /{filename}/{id} : Returns a single record by ID from the specified JSON file
+//   - POST /{filename} : Adds a new record to the specified JSON file
+//   - PUT /{filename}/{id} : Replaces a record by ID in the specified JSON file
+//   - PATCH /{filename}/{id} : Merges changes into a record by ID (RFC 7396 JSON Merge Patch)
+//   - DELETE /{filename}/{id} : Removes a record by ID from the specified JSON file
+//   - DELETE /{filename} : Empties or removes the specified JSON file, if enabled
+//   - PUT and PATCH /{filename} : Replace or merge into a file holding a single object, such as
+//     settings.json; {id} and {path...} then address members of the object
+//   - GET /{filename}/{id}/{path...} : Returns the value at a JSON Pointer path inside a record, or
+//     the records of the child collection that refer to the record, e.g. /customers/{id}/orders
+//   - PUT, PATCH and DELETE /{filename}/{id}/{path...} : Replace, merge into or remove the value at a
+//     JSON Pointer path inside a record
+//   - POST /{filename}/{id}/{child} : Adds a record to the child collection that refers to a record
+//   - OPTIONS on any of these paths : Lists the methods the path supports in an Allow header
 //
 // Returns:
 //   - http.Handler: The configured router with all middleware applied
@@ -23,11 +41,32 @@ func (app *application) routes() http.Handler {
 	standard := alice.New(app.recoverPanic, app.logRequest, commonHeaders)
 
 	// Static routes
-	mux.HandleFunc("GET /", app.home)
+	mux.HandleFunc("GET /{$}", app.home)
 
 	// Dynamic routes for JSON files
 	mux.HandleFunc("GET /{filename}", app.getFileRecords)
 	mux.HandleFunc("GET /{filename}/{id}", app.getFileRecordByID)
+	mux.HandleFunc("POST /{filename}", app.createFileRecord)
+	mux.HandleFunc("PUT /{filename}/{id}", app.replaceFileRecord)
+	mux.HandleFunc("PATCH /{filename}/{id}", app.patchFileRecord)
+	mux.HandleFunc("DELETE /{filename}/{id}", app.deleteFileRecord)
+	mux.HandleFunc("DELETE /{filename}", app.deleteFile)
+	mux.HandleFunc("PUT /{filename}", app.replaceFile)
+	mux.HandleFunc("PATCH /{filename}", app.patchFile)
+
+	// Paths inside records and nested routes for child collections,
+	// e.g. /customers/{id}/address/city and /customers/{id}/orders
+	mux.HandleFunc("GET /{filename}/{id}/{path...}", app.getRecordPath)
+	mux.HandleFunc("PUT /{filename}/{id}/{path...}", app.replaceRecordPath)
+	mux.HandleFunc("PATCH /{filename}/{id}/{path...}", app.patchRecordPath)
+	mux.HandleFunc("DELETE /{filename}/{id}/{path...}", app.deleteRecordPath)
+	mux.HandleFunc("POST /{filename}/{id}/{child}", app.createChildRecord)
+
+	// The methods each path supports; see allowedMethods
+	mux.HandleFunc("OPTIONS /{$}", app.options)
+	mux.HandleFunc("OPTIONS /{filename}", app.options)
+	mux.HandleFunc("OPTIONS /{filename}/{id}", app.options)
+	mux.HandleFunc("OPTIONS /{filename}/{id}/{path...}", app.options)
 
-	return standard.Then(mux)
+	return standard.Then(app.subCollections(app.unmatchedRoutes(mux)))
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/RAshkettle/getter/internal/files"
+	"github.com/RAshkettle/getter/internal/query"
+	"github.com/RAshkettle/getter/internal/store"
+)
+
+// streams reports whether a collection request is answered by streamRecords:
+// the collection is backed by an NDJSON file, the response is JSON or NDJSON
+// and the query only filters and projects its records, with no search, sort
+// order, pagination, _expand or _embed, all of which need every record at once.
+//
+// Parameters:
+//   - r: The HTTP request being processed
+//   - fileFormat: The format of the collection's data file
+//   - q: The parsed query string of the request
+//   - format: The negotiated response format
+//
+// Returns:
+//   - bool: True if the records can be streamed
+func (app *application) streams(r *http.Request, fileFormat string, q *query.Query, format *responseFormat) bool {
+	if format.name != "json" && format.name != "ndjson" {
+		return false
+	}
+	values := r.URL.Query()
+	if !q.Streamable() || values.Has("_expand") || values.Has("_embed") {
+		return false
+	}
+	return fileFormat == files.FormatNDJSON
+}
+
+// streamRecords answers a collection request by reading the records of an
+// NDJSON collection line by line and writing each selected record as soon as
+// it is read, so memory use doesn't grow with the size of the file. The
+// response is the same JSON array or NDJSON getFileRecords returns, but
+// without the X-Total-Count header, as the count is only known at the end.
+//
+// If the file turns out to be invalid before any record is written, a 500
+// Internal Server Error is returned; later, the error can only be logged and
+// the response is cut short.
+//
+// The server's write timeout is lifted for the response, as streaming a large
+// file can take longer than any fixed limit and a response cut off by the
+// deadline would look complete up to the last record sent. A client that stops
+// reading holds the connection until it is closed.
+//
+// Parameters:
+//   - w: The HTTP response writer for sending the response
+//   - r: The HTTP request being processed
+//   - name: The collection name
+//   - q: The parsed query string of the request
+//   - format: The negotiated response format, JSON or NDJSON
+func (app *application) streamRecords(w http.ResponseWriter, r *http.Request, name string, q *query.Query, format *responseFormat) {
+	// Not every ResponseWriter supports deadlines, such as those of tests,
+	// and without one there is nothing to lift
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", format.contentType)
+	var out recordWriter = &arrayWriter{w: w}
+	if format.name == "ndjson" {
+		out = &lineWriter{w: w}
+	}
+
+	written := 0
+	err := app.store.Stream(name, func(record map[string]interface{}) error {
+		if record, ok := q.Select(record); ok {
+			written++
+			return out.write(record)
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.collectionError(w, r, name, err)
+	case err != nil && written == 0:
+		app.serverError(w, r, fmt.Errorf("error streaming %s: %w", name, err))
+	case err != nil:
+		app.logger.Error(fmt.Sprintf("error streaming %s: %v", name, err), "method", r.Method, "uri", r.URL.RequestURI())
+	default:
+		out.close()
+	}
+}
+
+// recordWriter writes the records of a response one at a time.
+type recordWriter interface {
+	write(record map[string]interface{}) error
+	close() error
+}
+
+// lineWriter writes records as NDJSON, one per line.
+type lineWriter struct {
+	w io.Writer
+}
+
+// write adds a record as a line.
+func (l *lineWriter) write(record map[string]interface{}) error {
+	encoder := json.NewEncoder(l.w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(record)
+}
+
+// close does nothing, as NDJSON has no closing delimiter.
+func (l *lineWriter) close() error {
+	return nil
+}
+
+// arrayWriter writes a JSON array one element at a time, in the same layout
+// as store.EncodeJSON gives the whole array.
+type arrayWriter struct {
+	w     io.Writer
+	count int
+}
+
+// write adds an element to the array, opening it first if needed.
+func (a *arrayWriter) write(v map[string]interface{}) error {
+	var buf bytes.Buffer
+	if a.count == 0 {
+		buf.WriteString("[\n  ")
+	} else {
+		buf.WriteString(",\n  ")
+	}
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("  ", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+
+	if _, err := a.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	a.count++
+	return nil
+}
+
+// close ends the array.
+func (a *arrayWriter) close() error {
+	end := "\n]\n"
+	if a.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(a.w, end)
+	return err
+}
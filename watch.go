@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/RAshkettle/getter/internal/files"
+	"github.com/RAshkettle/getter/internal/store"
+	"github.com/RAshkettle/getter/internal/watch"
+)
+
+// watchData keeps the store in step with the data directory while getter runs.
+// It reads changes from the watcher until the watcher is closed, reloading
+// collections whose files are edited and dropping those whose files are
+// deleted or renamed away. New files need no action: they are listed by the
+// home endpoint and loaded on first request.
+//
+// Parameters:
+//   - w: The watcher for the data directory
+func (app *application) watchData(w *watch.Watcher) {
+	errs := w.Errors
+	for {
+		select {
+		case event, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			app.handleDataEvent(event)
+		case err, ok := <-errs:
+			if !ok {
+				// Keep reading events until they are closed as well
+				errs = nil
+				continue
+			}
+			app.logger.Error("error watching data directory", "error", err)
+		}
+	}
+}
+
+// handleDataEvent applies a single change in the data directory to the store
+// and logs it.
+//
+// Parameters:
+//   - event: The change to apply
+func (app *application) handleDataEvent(event watch.Event) {
+	if files.IsTemporary(event.Name) {
+		return
+	}
+	name, ok := store.CollectionName(event.Name)
+	if !ok {
+		return
+	}
+
+	switch {
+	case event.Op == watch.Remove:
+		app.store.Forget(name)
+		app.logger.Info("collection removed", "collection", name, "file", event.Name)
+	case event.Op == watch.Create && !app.store.Loaded(name):
+		app.logger.Info("collection added", "collection", name, "file", event.Name)
+	default:
+		// Writes, and files renamed over a loaded collection, including the
+		// store's own atomic writes, which Refresh recognizes and skips
+		reloaded, err := app.store.Refresh(name)
+		if err != nil {
+			app.logger.Error("error reloading collection, keeping previous version", "collection", name, "file", event.Name, "error", err)
+			return
+		}
+		if reloaded {
+			app.logger.Info("collection reloaded", "collection", name, "file", event.Name)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RAshkettle/getter/internal/watch"
+)
+
+// TestHandleDataEvent tests that changes to data files are applied to the store and logged
+func TestHandleDataEvent(t *testing.T) {
+	var logBuffer bytes.Buffer
+	app := newTestApp(t, map[string]string{"products.json": testProducts})
+	app.logger = slog.New(slog.NewTextHandler(&logBuffer, nil))
+	path := filepath.Join(app.dataPath, "products.json")
+
+	// Load the collection so there is something to reload
+	if _, err := app.store.Collection("products"); err != nil {
+		t.Fatalf("Failed to load collection: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		content     string
+		event       watch.Event
+		expectedLog string
+		expected    string
+	}{
+		{
+			name:        "Edited file is reloaded",
+			content:     `{"products": [{"id": 1, "title": "Edited by hand"}]}`,
+			event:       watch.Event{Name: "products.json", Op: watch.Write},
+			expectedLog: "collection reloaded",
+			expected:    "Edited by hand",
+		},
+		{
+			name:        "Broken file keeps the previous version",
+			content:     `{"products": [{"id": 1, "title": "Half`,
+			event:       watch.Event{Name: "products.json", Op: watch.Write},
+			expectedLog: "keeping previous version",
+			expected:    "Edited by hand",
+		},
+		{
+			name:        "File renamed over the collection is reloaded",
+			content:     `{"products": [{"id": 1, "title": "Renamed into place"}]}`,
+			event:       watch.Event{Name: "products.json", Op: watch.Create},
+			expectedLog: "collection reloaded",
+			expected:    "Renamed into place",
+		},
+		{
+			name:        "New file is announced",
+			event:       watch.Event{Name: "orders.json", Op: watch.Create},
+			expectedLog: "collection added",
+			expected:    "Renamed into place",
+		},
+		{
+			name:     "Temporary files are ignored",
+			event:    watch.Event{Name: ".getter-products.json-123.tmp", Op: watch.Create},
+			expected: "Renamed into place",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logBuffer.Reset()
+
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatalf("Failed to write file: %v", err)
+				}
+				// Make sure the change is visible even on coarse timestamps
+				modTime := time.Now().Add(time.Duration(i+1) * time.Second)
+				os.Chtimes(path, modTime, modTime)
+			}
+
+			app.handleDataEvent(tt.event)
+
+			if !strings.Contains(logBuffer.String(), tt.expectedLog) {
+				t.Errorf("Expected log to contain %q, log output: %s", tt.expectedLog, logBuffer.String())
+			}
+			if tt.expectedLog == "" && logBuffer.Len() > 0 {
+				t.Errorf("Expected no log output, got: %s", logBuffer.String())
+			}
+
+			c, err := app.store.Collection("products")
+			if err != nil {
+				t.Fatalf("Failed to get collection: %v", err)
+			}
+			if record, _ := c.Get("1"); record["title"] != tt.expected {
+				t.Errorf("Expected title %q, got %v", tt.expected, record["title"])
+			}
+		})
+	}
+}
+
+// TestWatchDataEndToEnd tests that a running watcher makes hand edits and
+// deletions visible to requests without a restart
+func TestWatchDataEndToEnd(t *testing.T) {
+	app := newTestApp(t, map[string]string{"products.json": testProducts})
+	path := filepath.Join(app.dataPath, "products.json")
+
+	watcher, err := watch.NewPolling(app.dataPath, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		app.watchData(watcher)
+		close(done)
+	}()
+	defer func() {
+		watcher.Close()
+		<-done
+	}()
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	// Load the collection, then edit the file by hand
+	if w := get("/products/1"); !strings.Contains(w.Body.String(), "Ultra Slim Laptop Pro") {
+		t.Fatalf("Unexpected initial record: %s", w.Body.String())
+	}
+	if err := os.WriteFile(path, []byte(`{"products": [{"id": 1, "title": "Edited by hand"}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	waitFor(t, func() bool {
+		return strings.Contains(get("/products/1").Body.String(), "Edited by hand")
+	})
+
+	// Deleting the file removes the collection
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	waitFor(t, func() bool {
+		return get("/products").Code != http.StatusOK
+	})
+}
+
+// waitFor polls condition until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
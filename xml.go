@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// xsiNamespace is the XML Schema instance namespace, which defines the
+// xsi:nil attribute marking null values.
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// encodeXML writes a decoded JSON value as an XML document indented by two
+// spaces. The root element is <records> for an array, holding a <record>
+// element per record, and <object> for an object. Object members become
+// elements named after their keys, in sorted order; keys that aren't valid
+// XML names become <field name="..."> elements. The elements of nested arrays
+// are <item> elements, and null values are empty elements with xsi:nil="true".
+//
+// Parameters:
+//   - v: The value to write
+//
+// Returns:
+//   - []byte: The XML document
+//   - error: An error if the value can't be written
+func encodeXML(v interface{}) ([]byte, error) {
+	root, item := "object", "item"
+	if _, ok := v.([]interface{}); ok {
+		root, item = "records", "record"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+
+	start := xml.StartElement{
+		Name: xml.Name{Local: root},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns:xsi"}, Value: xsiNamespace}},
+	}
+	if err := writeXML(encoder, start, v, item); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// writeXML writes a value as the element started by start. The elements of
+// an array are named item.
+func writeXML(encoder *xml.Encoder, start xml.StartElement, value interface{}, item string) error {
+	if value == nil {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xsi:nil"}, Value: "true"})
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		return encoder.EncodeToken(start.End())
+	}
+
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := writeXML(encoder, xmlElement(key), v[key], "item"); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, element := range v {
+			if err := writeXML(encoder, xml.StartElement{Name: xml.Name{Local: item}}, element, "item"); err != nil {
+				return err
+			}
+		}
+	default:
+		text, err := xmlText(v)
+		if err != nil {
+			return err
+		}
+		if err := encoder.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// xmlElement returns the start of the element for an object member.
+func xmlElement(key string) xml.StartElement {
+	if isXMLName(key) {
+		return xml.StartElement{Name: xml.Name{Local: key}}
+	}
+	return xml.StartElement{
+		Name: xml.Name{Local: "field"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: key}},
+	}
+}
+
+// isXMLName reports whether a key can be used as an element name as is: it
+// starts with a letter or underscore, holds only letters, digits, hyphens,
+// periods and underscores, and doesn't start with the reserved "xml".
+func isXMLName(key string) bool {
+	if key == "" || strings.HasPrefix(strings.ToLower(key), "xml") {
+		return false
+	}
+	for i, r := range key {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// xmlText formats a scalar value as element text.
+func xmlText(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	}
+	return "", fmt.Errorf("can't write %T as XML", value)
+}